@@ -24,6 +24,14 @@ typedef struct { const char *p; ptrdiff_t n; } _GoString_;
 #include <stdlib.h>
 #include <stdio.h>
 
+#define AMANTYA_OK                     0
+#define AMANTYA_ERR                   -1
+#define AMANTYA_ERR_NOT_FOUND         -2
+#define AMANTYA_ERR_NOT_PERMITTED     -3
+#define AMANTYA_ERR_INVALID_OPERATION -4
+#define AMANTYA_ERR_INVALID_LABEL     -5
+#define AMANTYA_ERR_CARDINALITY       -6
+
 #line 1 "cgo-generated-wrapper"
 
 
@@ -81,12 +89,17 @@ extern "C" {
 #endif
 
 extern int Initialize(char* backendType, char* namespace);
+extern int InitializeWithLabels(char* backendType, char* namespace, char** constLabels, int count);
 extern int LoadKPIs(char* filePath);
 extern int RegisterMetrics();
 extern int IncrementMetric(char* metricName, char** labels, int count);
 extern int DecrementMetric(char* metricName, char** labels, int count);
 extern int AddToMetric(char* metricName, double value, char** labels, int count);
 extern int SetMetric(char* metricName, double value, char** labels, int count);
+extern int ObserveMetric(char* metricName, double value, char** labels, int count);
+extern int GetMetricValue(char* metricName, char** labels, int count, double* value);
+extern int DeleteSeries(char* metricName, char** labels, int count);
+extern int DeletePartialMatch(char* metricName, char** labels, int count);
 extern int PushMetrics(char* gatewayURL, char* jobName);
 extern char** ListMetrics();
 extern void FreeStringArray(char** array, int length);
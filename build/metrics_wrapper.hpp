@@ -1,13 +1,26 @@
 #pragma once
 
+#define AMANTYA_OK                     0
+#define AMANTYA_ERR                   -1
+#define AMANTYA_ERR_NOT_FOUND         -2
+#define AMANTYA_ERR_NOT_PERMITTED     -3
+#define AMANTYA_ERR_INVALID_OPERATION -4
+#define AMANTYA_ERR_INVALID_LABEL     -5
+#define AMANTYA_ERR_CARDINALITY       -6
+
 extern "C" {
     int Initialize(char* backend, char* namespaceName);
+    int InitializeWithLabels(char* backend, char* namespaceName, char** constLabels, int labelCount);
     int LoadKPIs(char* path);
     int RegisterMetrics();
     int IncrementMetric(char* metricName, char** labels, int labelCount);
     int DecrementMetric(char* metricName, char** labels, int labelCount);
     int AddToMetric(char* metricName, double value, char** labels, int labelCount);
     int SetMetric(char* metricName, double value, char** labels, int labelCount);
+    int ObserveMetric(char* metricName, double value, char** labels, int labelCount);
+    int GetMetricValue(char* metricName, char** labels, int labelCount, double* value);
+    int DeleteSeries(char* metricName, char** labels, int labelCount);
+    int DeletePartialMatch(char* metricName, char** labels, int labelCount);
     char** ListMetrics();
     void FreeStringArray(char** arr, int length);
     int PushMetrics(char* gatewayURL, char* jobName);
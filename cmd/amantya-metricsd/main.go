@@ -0,0 +1,94 @@
+package main
+
+import (
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/pmexport"
+	"amantya_metrics/service"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	backend := flag.String("backend", string(metrics_wrapper.PrometheusBackend), "metrics backend (prometheus, datadog, otlp, remote_write, influx) or a comma-separated list of them")
+	namespace := flag.String("namespace", "", "metric namespace passed to the backend")
+	backendAddr := flag.String("backend-addr", "", "DogStatsD address, OTLP receiver endpoint, remote-write URL or Influx write URL")
+	transport := flag.String("transport", "", "backend transport (udp, uds for datadog; grpc, http for otlp; http, udp for influx)")
+	insecure := flag.Bool("insecure", false, "export OTLP without TLS")
+	exportInterval := flag.Duration("export-interval", 0, "OTLP, remote-write and Influx export interval (0 = backend default)")
+	kpiPath := flag.String("kpis", "models/kpi.json", "path to the KPI catalogue")
+	addr := flag.String("addr", service.DefaultAddr, "HTTP listen address")
+	defaults := flag.Bool("init-defaults", true, "initialize every KPI with a zero value")
+	granularity := flag.Duration("pm-granularity", 0, "granularity period of the default PM job, e.g. 15m (0 disables it)")
+	retention := flag.Int("pm-retention", metrics_wrapper.DefaultPMRetention, "period reports kept by the default PM job")
+	pmDir := flag.String("pm-dir", "", "directory for TS 32.435 measurement files of the default PM job")
+	localDN := flag.String("pm-local-dn", "", "local DN of the managed element in measurement files, e.g. ManagedElement=amf-1")
+	maxFiles := flag.Int("pm-max-files", 0, "measurement files kept (0 = no limit)")
+	maxAge := flag.Duration("pm-max-age", 0, "age after which measurement files are deleted (0 = no limit)")
+	flag.Parse()
+
+	options := make(map[string]interface{})
+	if *namespace != "" {
+		options["namespace"] = *namespace
+	}
+	if *backendAddr != "" {
+		options[metrics_wrapper.OptAddress] = *backendAddr
+	}
+	if *transport != "" {
+		options[metrics_wrapper.OptTransport] = *transport
+	}
+	if *insecure {
+		options[metrics_wrapper.OptInsecure] = true
+	}
+	if *exportInterval > 0 {
+		options[metrics_wrapper.OptExportInterval] = *exportInterval
+	}
+
+	framework, err := metrics_wrapper.MetricsType(metrics_wrapper.BackendType(*backend), options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer framework.Close()
+
+	if err := framework.LoadKPIs(*kpiPath); err != nil {
+		log.Fatal(err)
+	}
+	if err := framework.RegisterMetrics(); err != nil {
+		log.Fatal(err)
+	}
+	if *defaults {
+		if err := framework.InitializeDefaults(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *granularity > 0 {
+		cfg := metrics_wrapper.PMJobConfig{Granularity: *granularity, Retention: *retention}
+		if *pmDir != "" {
+			exporter, err := pmexport.NewXMLExporter(pmexport.Config{
+				Dir:      *pmDir,
+				LocalDN:  *localDN,
+				MaxFiles: *maxFiles,
+				MaxAge:   *maxAge,
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			cfg.OnReport = append(cfg.OnReport, exporter.OnReport)
+		}
+		if err := framework.StartPMJob(cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := service.NewServer(framework, service.Config{Addr: *addr})
+	if err := server.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
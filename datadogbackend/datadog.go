@@ -3,50 +3,236 @@ package datadogbackend
 import (
 	"amantya_metrics/metricsInterface"
 	"fmt"
-	"log"
-	"os"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
-type DataDogMetric struct {
+// DataDogCounter tracks the running total per label set so fractional
+// increments are not lost: DogStatsD counts are integers, so only the whole
+// units crossed by each update are sent.
+type DataDogCounter struct {
 	client *statsd.Client
 	name   string
+	tags   []string
+	state  *seriesState
 }
 
-func (dm *DataDogMetric) Inc(labels map[string]string) error {
-	tags := convertLabelsToTags(labels)
-	log.Printf("Datadog: Incrementing metric %s with labels %v", dm.name, labels)
-
-	return dm.client.Incr(dm.name, tags, 1)
+func (dc *DataDogCounter) Inc(labels map[string]string) error {
+	return dc.Add(1, labels)
 }
 
-func (dm *DataDogMetric) Dec(labels map[string]string) error {
-	tags := convertLabelsToTags(labels)
-	return dm.client.Decr(dm.name, tags, 1)
+func (dc *DataDogCounter) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
 }
 
-func (dm *DataDogMetric) Add(value float64, labels map[string]string) error {
-	tags := convertLabelsToTags(labels)
-	return dm.client.Count(dm.name, int64(value), tags, 1)
+func (dc *DataDogCounter) Add(value float64, labels map[string]string) error {
+	if value < 0 {
+		return fmt.Errorf("%w: counter cannot decrease", metricsInterface.ErrInvalidOperation)
+	}
+
+	return dc.state.update(labels, func(v float64) float64 { return v + value }, func(old, updated float64) error {
+		delta := int64(math.Floor(updated) - math.Floor(old))
+		if delta == 0 {
+			return nil
+		}
+		return dc.client.Count(dc.name, delta, metricTags(dc.tags, labels), 1)
+	})
 }
 
-func (dm *DataDogMetric) Set(value float64, labels map[string]string) error {
-	tags := convertLabelsToTags(labels)
-	log.Printf("Datadog: Setting metric '%s' = %f with labels %v", dm.name, value, labels)
-	return dm.client.Gauge(dm.name, value, tags, 1)
+func (dc *DataDogCounter) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
 }
 
-func (dm *DataDogMetric) Observe(value float64, labels map[string]string) error {
+func (dc *DataDogCounter) Observe(value float64, labels map[string]string) error {
 	return metricsInterface.ErrInvalidOperation
 }
 
-func (dm *DataDogMetric) GetMetricType() metricsInterface.MetricType {
-	// DataDog doesn't strictly distinguish between counter and gauge in the client
-	// We'll treat all metrics as counters unless they use Set
+func (dc *DataDogCounter) GetMetricType() metricsInterface.MetricType {
 	return metricsInterface.CounterType
 }
 
+func (dc *DataDogCounter) DeleteSeries(labels map[string]string) bool {
+	return dc.state.delete(labels)
+}
+
+func (dc *DataDogCounter) DeletePartialMatch(labels map[string]string) int {
+	return dc.state.deletePartialMatch(labels)
+}
+
+func (dc *DataDogCounter) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return dc.state.value(labels)
+}
+
+func (dc *DataDogCounter) Series() ([]metricsInterface.Sample, error) {
+	return dc.state.series(), nil
+}
+
+// DataDogGauge keeps the gauge value client-side and always sends the
+// absolute value, so Inc/Dec/Add behave like a Prometheus gauge.
+type DataDogGauge struct {
+	client *statsd.Client
+	name   string
+	tags   []string
+	state  *seriesState
+}
+
+func (dg *DataDogGauge) Inc(labels map[string]string) error {
+	return dg.Add(1, labels)
+}
+
+func (dg *DataDogGauge) Dec(labels map[string]string) error {
+	return dg.Add(-1, labels)
+}
+
+func (dg *DataDogGauge) Add(value float64, labels map[string]string) error {
+	return dg.state.update(labels, func(v float64) float64 { return v + value }, dg.send(labels))
+}
+
+func (dg *DataDogGauge) Set(value float64, labels map[string]string) error {
+	return dg.state.update(labels, func(float64) float64 { return value }, dg.send(labels))
+}
+
+// send returns the update callback sending the new absolute value.
+func (dg *DataDogGauge) send(labels map[string]string) func(old, updated float64) error {
+	return func(_, updated float64) error {
+		return dg.client.Gauge(dg.name, updated, metricTags(dg.tags, labels), 1)
+	}
+}
+
+func (dg *DataDogGauge) Observe(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dg *DataDogGauge) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.GaugeType
+}
+
+func (dg *DataDogGauge) DeleteSeries(labels map[string]string) bool {
+	return dg.state.delete(labels)
+}
+
+func (dg *DataDogGauge) DeletePartialMatch(labels map[string]string) int {
+	return dg.state.deletePartialMatch(labels)
+}
+
+func (dg *DataDogGauge) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return dg.state.value(labels)
+}
+
+func (dg *DataDogGauge) Series() ([]metricsInterface.Sample, error) {
+	return dg.state.series(), nil
+}
+
+// DataDogHistogram sends observations as a DogStatsD histogram; the agent
+// aggregates them per host.
+type DataDogHistogram struct {
+	client *statsd.Client
+	name   string
+	tags   []string
+	state  *seriesState
+}
+
+func (dh *DataDogHistogram) Inc(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dh *DataDogHistogram) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dh *DataDogHistogram) Add(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dh *DataDogHistogram) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dh *DataDogHistogram) Observe(value float64, labels map[string]string) error {
+	dh.state.observe(labels, value)
+	return dh.client.Histogram(dh.name, value, metricTags(dh.tags, labels), 1)
+}
+
+func (dh *DataDogHistogram) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.HistogramType
+}
+
+func (dh *DataDogHistogram) DeleteSeries(labels map[string]string) bool {
+	return dh.state.delete(labels)
+}
+
+func (dh *DataDogHistogram) DeletePartialMatch(labels map[string]string) int {
+	return dh.state.deletePartialMatch(labels)
+}
+
+func (dh *DataDogHistogram) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return dh.state.value(labels)
+}
+
+func (dh *DataDogHistogram) Series() ([]metricsInterface.Sample, error) {
+	return dh.state.series(), nil
+}
+
+// DataDogDistribution reports observations as a DogStatsD distribution so the
+// quantiles are computed server side across all hosts.
+type DataDogDistribution struct {
+	client *statsd.Client
+	name   string
+	tags   []string
+	state  *seriesState
+}
+
+func (dd *DataDogDistribution) Inc(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dd *DataDogDistribution) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dd *DataDogDistribution) Add(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dd *DataDogDistribution) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (dd *DataDogDistribution) Observe(value float64, labels map[string]string) error {
+	dd.state.observe(labels, value)
+	return dd.client.Distribution(dd.name, value, metricTags(dd.tags, labels), 1)
+}
+
+func (dd *DataDogDistribution) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.SummaryType
+}
+
+func (dd *DataDogDistribution) DeleteSeries(labels map[string]string) bool {
+	return dd.state.delete(labels)
+}
+
+func (dd *DataDogDistribution) DeletePartialMatch(labels map[string]string) int {
+	return dd.state.deletePartialMatch(labels)
+}
+
+func (dd *DataDogDistribution) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return dd.state.value(labels)
+}
+
+func (dd *DataDogDistribution) Series() ([]metricsInterface.Sample, error) {
+	return dd.state.series(), nil
+}
+
+// metricTags combines a metric's constant tags with the per-call labels.
+func metricTags(constTags []string, labels map[string]string) []string {
+	tags := make([]string, 0, len(constTags)+len(labels))
+	tags = append(tags, constTags...)
+	return append(tags, convertLabelsToTags(labels)...)
+}
+
 func convertLabelsToTags(labels map[string]string) []string {
 	tags := make([]string, 0, len(labels))
 	for k, v := range labels {
@@ -55,18 +241,47 @@ func convertLabelsToTags(labels map[string]string) []string {
 	return tags
 }
 
+const (
+	TransportUDP = "udp"
+	TransportUDS = "uds"
+
+	DefaultAddress   = "localhost:8125"
+	DefaultSocket    = "/var/run/datadog/dsd.socket"
+	DefaultNamespace = "amantya"
+)
+
+// Config describes how the backend reaches the DogStatsD agent.
+// Address is host:port for UDP or a socket path for UDS.
+type Config struct {
+	Address   string
+	Namespace string
+	Tags      []string
+	Transport string
+}
+
 type DataDogBackend struct {
 	client    *statsd.Client
 	namespace string
+	constTags []string
 }
 
-func NewDataDogBackend(namespace string) (*DataDogBackend, error) {
-	// You can configure the address based on your environment
-	// Default is "localhost:8125" for UDP
-	client, err := statsd.New("localhost:8125",
-		statsd.WithNamespace(namespace),
-		statsd.WithTags([]string{fmt.Sprintf("service:%s", os.Getenv("DD_SERVICE"))}),
-	)
+func NewDataDogBackend(cfg Config) (*DataDogBackend, error) {
+	addr, err := resolveAddress(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	opts := []statsd.Option{statsd.WithNamespace(namespace)}
+	if len(cfg.Tags) > 0 {
+		opts = append(opts, statsd.WithTags(cfg.Tags))
+	}
+
+	client, err := statsd.New(addr, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create DataDog client: %w", err)
 	}
@@ -77,22 +292,73 @@ func NewDataDogBackend(namespace string) (*DataDogBackend, error) {
 	}, nil
 }
 
+func resolveAddress(cfg Config) (string, error) {
+	switch strings.ToLower(cfg.Transport) {
+	case "", TransportUDP:
+		if cfg.Address == "" {
+			return DefaultAddress, nil
+		}
+		return cfg.Address, nil
+	case TransportUDS:
+		addr := cfg.Address
+		if addr == "" {
+			addr = DefaultSocket
+		}
+		if !strings.HasPrefix(addr, statsd.UnixAddressPrefix) {
+			addr = statsd.UnixAddressPrefix + addr
+		}
+		return addr, nil
+	default:
+		return "", fmt.Errorf("unsupported DogStatsD transport %q", cfg.Transport)
+	}
+}
+
+// WithConstLabels returns a view of the backend whose metrics send labels as
+// tags on every sample, in addition to the client's global tags.
+func (db *DataDogBackend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	return &DataDogBackend{
+		client:    db.client,
+		namespace: db.namespace,
+		constTags: convertLabelsToTags(labels),
+	}
+}
+
 func (db *DataDogBackend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
-	return &DataDogMetric{
+	return &DataDogCounter{
 		client: db.client,
 		name:   name,
+		tags:   db.constTags,
+		state:  newSeriesState(),
 	}, nil
 }
 
 func (db *DataDogBackend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
-	return &DataDogMetric{
+	return &DataDogGauge{
 		client: db.client,
 		name:   name,
+		tags:   db.constTags,
+		state:  newSeriesState(),
 	}, nil
 }
 
 func (db *DataDogBackend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
-	return nil, metricsInterface.ErrBackendNotSupported
+	// Buckets are not part of the DogStatsD protocol; percentiles are configured on the agent
+	return &DataDogHistogram{
+		client: db.client,
+		name:   name,
+		tags:   db.constTags,
+		state:  newObservationState(),
+	}, nil
+}
+
+func (db *DataDogBackend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	// Quantile objectives and max age are configured on the Datadog side for distributions
+	return &DataDogDistribution{
+		client: db.client,
+		name:   name,
+		tags:   db.constTags,
+		state:  newObservationState(),
+	}, nil
 }
 
 func (db *DataDogBackend) PushToGateway(gatewayURL, jobName string) error {
@@ -100,3 +366,8 @@ func (db *DataDogBackend) PushToGateway(gatewayURL, jobName string) error {
 	// Flush any buffered metrics
 	return db.client.Flush()
 }
+
+// Close flushes the buffered metrics and closes the DogStatsD client.
+func (db *DataDogBackend) Close() error {
+	return db.client.Close()
+}
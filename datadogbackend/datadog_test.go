@@ -0,0 +1,192 @@
+package datadogbackend
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// datagram is one DogStatsD line: name:value|type|#tags.
+type datagram struct {
+	name, value, kind string
+	tags              []string
+}
+
+func parseDatagrams(t *testing.T, packet string) []datagram {
+	t.Helper()
+
+	var out []datagram
+	for _, line := range strings.Split(strings.TrimSpace(packet), "\n") {
+		fields := strings.Split(line, "|")
+		name, value, ok := strings.Cut(fields[0], ":")
+		if !ok || len(fields) < 2 {
+			t.Fatalf("malformed datagram %q", line)
+		}
+		d := datagram{name: name, value: value, kind: fields[1]}
+		for _, f := range fields[2:] {
+			if tags, ok := strings.CutPrefix(f, "#"); ok {
+				d.tags = strings.Split(tags, ",")
+				slices.Sort(d.tags)
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// listen opens a stand-in agent and returns a function reading the
+// datagrams the client sent.
+func listen(t *testing.T, network, address string) (net.PacketConn, func() []datagram) {
+	t.Helper()
+
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	read := func() []datagram {
+		t.Helper()
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no datagram received: %v", err)
+		}
+		return parseDatagrams(t, string(buf[:n]))
+	}
+	return conn, read
+}
+
+func newTestBackend(t *testing.T, cfg Config) *DataDogBackend {
+	t.Helper()
+
+	db, err := NewDataDogBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUDP(t *testing.T) {
+	conn, read := listen(t, "udp", "127.0.0.1:0")
+	db := newTestBackend(t, Config{Address: conn.LocalAddr().String(), Namespace: "amf", Tags: []string{"env:lab"}})
+
+	counter, err := db.NewCounter("registrations", "", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := counter.Inc(map[string]string{"NetworkSlice": "slice1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	got := read()
+	want := []datagram{{name: "amf.registrations", value: "1", kind: "c", tags: []string{"NetworkSlice:slice1", "env:lab"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+}
+
+func TestDefaultNamespace(t *testing.T) {
+	conn, read := listen(t, "udp", "127.0.0.1:0")
+	db := newTestBackend(t, Config{Address: conn.LocalAddr().String()})
+
+	summary, err := db.NewSummary("setup_time", "", nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := summary.Observe(0.5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close flushes what is still buffered
+	if got := read(); len(got) != 1 || got[0].name != "amantya.setup_time" || got[0].kind != "d" {
+		t.Errorf("received %+v, want the amantya.setup_time distribution", got)
+	}
+}
+
+func TestUDS(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+	_, read := listen(t, "unixgram", socket)
+	db := newTestBackend(t, Config{Address: socket, Transport: "UDS"})
+
+	counter, err := db.NewCounter("registrations", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := counter.Inc(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); len(got) != 1 || got[0].name != "amantya.registrations" {
+		t.Errorf("received %+v over the socket, want amantya.registrations", got)
+	}
+}
+
+func TestResolveAddress(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, DefaultAddress},
+		{Config{Transport: "udp", Address: "agent:8125"}, "agent:8125"},
+		{Config{Transport: "uds"}, "unix://" + DefaultSocket},
+		{Config{Transport: "uds", Address: "/run/dsd.sock"}, "unix:///run/dsd.sock"},
+		{Config{Transport: "uds", Address: "unix:///run/dsd.sock"}, "unix:///run/dsd.sock"},
+	}
+	for _, tt := range tests {
+		if got, err := resolveAddress(tt.cfg); err != nil || got != tt.want {
+			t.Errorf("resolveAddress(%+v) = %q, %v, want %q", tt.cfg, got, err, tt.want)
+		}
+	}
+
+	if _, err := NewDataDogBackend(Config{Transport: "tcp"}); err == nil || !strings.Contains(err.Error(), `unsupported DogStatsD transport "tcp"`) {
+		t.Errorf("NewDataDogBackend with transport tcp = %v, want an unsupported transport error", err)
+	}
+}
+
+func TestConcurrentGaugeUpdates(t *testing.T) {
+	conn, read := listen(t, "udp", "127.0.0.1:0")
+	db := newTestBackend(t, Config{Address: conn.LocalAddr().String()})
+	gauge, err := db.NewGauge("active_sessions", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, updates = 16, 500
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				gauge.Inc(nil)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := db.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent keeps the last value it was sent, which has to be the final one
+	got := read()
+	if last := got[len(got)-1]; last.kind != "g" || last.value != strconv.Itoa(workers*updates) {
+		t.Errorf("last gauge sample %+v, want %d", last, workers*updates)
+	}
+}
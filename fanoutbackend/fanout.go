@@ -0,0 +1,235 @@
+package fanoutbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Child is one backend behind the fan-out, named for error messages.
+type Child struct {
+	Name    string
+	Backend metricsInterface.Backend
+}
+
+// FanoutMetric applies every operation to the metric of each child backend.
+// All children are updated even if one fails; the failures are joined, each
+// prefixed with the child's name. Reads are answered by the first child.
+type FanoutMetric struct {
+	names   []string
+	metrics []metricsInterface.Metric
+}
+
+func (fm *FanoutMetric) each(fn func(metricsInterface.Metric) error) error {
+	var errs []error
+	for i, m := range fm.metrics {
+		if err := fn(m); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", fm.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (fm *FanoutMetric) Inc(labels map[string]string) error {
+	return fm.each(func(m metricsInterface.Metric) error { return m.Inc(labels) })
+}
+
+func (fm *FanoutMetric) Dec(labels map[string]string) error {
+	return fm.each(func(m metricsInterface.Metric) error { return m.Dec(labels) })
+}
+
+func (fm *FanoutMetric) Add(value float64, labels map[string]string) error {
+	return fm.each(func(m metricsInterface.Metric) error { return m.Add(value, labels) })
+}
+
+func (fm *FanoutMetric) Set(value float64, labels map[string]string) error {
+	return fm.each(func(m metricsInterface.Metric) error { return m.Set(value, labels) })
+}
+
+func (fm *FanoutMetric) Observe(value float64, labels map[string]string) error {
+	return fm.each(func(m metricsInterface.Metric) error { return m.Observe(value, labels) })
+}
+
+func (fm *FanoutMetric) GetMetricType() metricsInterface.MetricType {
+	return fm.metrics[0].GetMetricType()
+}
+
+func (fm *FanoutMetric) DeleteSeries(labels map[string]string) bool {
+	deleted := false
+	for _, m := range fm.metrics {
+		if m.DeleteSeries(labels) {
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// DeletePartialMatch deletes from every child and returns the count of the
+// first, like the other reads.
+func (fm *FanoutMetric) DeletePartialMatch(labels map[string]string) int {
+	deleted := fm.metrics[0].DeletePartialMatch(labels)
+	for _, m := range fm.metrics[1:] {
+		m.DeletePartialMatch(labels)
+	}
+	return deleted
+}
+
+func (fm *FanoutMetric) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return fm.metrics[0].Value(labels)
+}
+
+func (fm *FanoutMetric) Series() ([]metricsInterface.Sample, error) {
+	return fm.metrics[0].Series()
+}
+
+// FanoutBackend writes to several backends at once, e.g. Datadog and
+// Prometheus during a migration. The first child is the primary: it answers
+// reads and, if it can be scraped, serves the scrape endpoint.
+type FanoutBackend struct {
+	children []Child
+}
+
+func NewFanoutBackend(children ...Child) (*FanoutBackend, error) {
+	if len(children) == 0 {
+		return nil, errors.New("fan-out backend needs at least one child backend")
+	}
+	return &FanoutBackend{children: children}, nil
+}
+
+// Children returns the child backends in order.
+func (fb *FanoutBackend) Children() []Child {
+	return fb.children
+}
+
+// view returns a fan-out over the backends produced by fn for each child.
+func (fb *FanoutBackend) view(fn func(metricsInterface.Backend) metricsInterface.Backend) *FanoutBackend {
+	children := make([]Child, len(fb.children))
+	for i, child := range fb.children {
+		children[i] = Child{Name: child.Name, Backend: fn(child.Backend)}
+	}
+	return &FanoutBackend{children: children}
+}
+
+func (fb *FanoutBackend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	return fb.view(func(b metricsInterface.Backend) metricsInterface.Backend {
+		return b.WithConstLabels(labels)
+	})
+}
+
+// WithUnit passes the unit on to the children that use it.
+func (fb *FanoutBackend) WithUnit(unit string) metricsInterface.Backend {
+	return fb.view(func(b metricsInterface.Backend) metricsInterface.Backend {
+		if ib, ok := b.(metricsInterface.InstrumentBackend); ok {
+			return ib.WithUnit(unit)
+		}
+		return b
+	})
+}
+
+// WithNFType passes the NF type on to the children that tag with it.
+func (fb *FanoutBackend) WithNFType(nfType string) metricsInterface.Backend {
+	return fb.view(func(b metricsInterface.Backend) metricsInterface.Backend {
+		if tb, ok := b.(metricsInterface.TaggingBackend); ok {
+			return tb.WithNFType(nfType)
+		}
+		return b
+	})
+}
+
+// newMetric creates the metric on every child and fails if any child fails,
+// as a metric missing from one child would silently diverge. Children that
+// did create it keep it, since backends cannot drop a metric; creation is
+// idempotent on each of them (Prometheus hands back the registered
+// collector), so registering again once the failing child recovers reuses
+// those metrics.
+func (fb *FanoutBackend) newMetric(create func(metricsInterface.Backend) (metricsInterface.Metric, error)) (metricsInterface.Metric, error) {
+	fm := &FanoutMetric{}
+	var errs []error
+	for _, child := range fb.children {
+		m, err := create(child.Backend)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", child.Name, err))
+			continue
+		}
+		fm.names = append(fm.names, child.Name)
+		fm.metrics = append(fm.metrics, m)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return fm, nil
+}
+
+func (fb *FanoutBackend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return fb.newMetric(func(b metricsInterface.Backend) (metricsInterface.Metric, error) {
+		return b.NewCounter(name, help, labels)
+	})
+}
+
+func (fb *FanoutBackend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return fb.newMetric(func(b metricsInterface.Backend) (metricsInterface.Metric, error) {
+		return b.NewGauge(name, help, labels)
+	})
+}
+
+// NewUpDownCounter creates an up-down counter on the children that have one
+// and a plain gauge on the others.
+func (fb *FanoutBackend) NewUpDownCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return fb.newMetric(func(b metricsInterface.Backend) (metricsInterface.Metric, error) {
+		if ib, ok := b.(metricsInterface.InstrumentBackend); ok {
+			return ib.NewUpDownCounter(name, help, labels)
+		}
+		return b.NewGauge(name, help, labels)
+	})
+}
+
+func (fb *FanoutBackend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
+	return fb.newMetric(func(b metricsInterface.Backend) (metricsInterface.Metric, error) {
+		return b.NewHistogram(name, help, labels, buckets)
+	})
+}
+
+func (fb *FanoutBackend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	return fb.newMetric(func(b metricsInterface.Backend) (metricsInterface.Metric, error) {
+		return b.NewSummary(name, help, labels, objectives, maxAge)
+	})
+}
+
+// PushToGateway pushes or flushes every child and joins their errors.
+func (fb *FanoutBackend) PushToGateway(gatewayURL, jobName string) error {
+	var errs []error
+	for _, child := range fb.children {
+		if err := child.Backend.PushToGateway(gatewayURL, jobName); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", child.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Handler serves the scrape endpoint of the first child that has one.
+func (fb *FanoutBackend) Handler() http.Handler {
+	for _, child := range fb.children {
+		if sb, ok := child.Backend.(metricsInterface.ScrapeBackend); ok {
+			return sb.Handler()
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, metricsInterface.ErrBackendNotSupported.Error(), http.StatusNotImplemented)
+	})
+}
+
+// Close closes the children that need it, such as OTLP.
+func (fb *FanoutBackend) Close() error {
+	var errs []error
+	for _, child := range fb.children {
+		if closer, ok := child.Backend.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", child.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,226 @@
+package fanoutbackend_test
+
+import (
+	"amantya_metrics/fanoutbackend"
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metricstest"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errBroken = errors.New("agent unreachable")
+
+// broken is a child backend whose metrics fail every write or, with refuse,
+// which fails to create metrics at all.
+type broken struct {
+	*metricstest.Backend
+	refuse bool
+	closed bool
+}
+
+type brokenMetric struct {
+	metricsInterface.Metric
+}
+
+func (brokenMetric) Inc(map[string]string) error              { return errBroken }
+func (brokenMetric) Dec(map[string]string) error              { return errBroken }
+func (brokenMetric) Add(float64, map[string]string) error     { return errBroken }
+func (brokenMetric) Set(float64, map[string]string) error     { return errBroken }
+func (brokenMetric) Observe(float64, map[string]string) error { return errBroken }
+
+func (b *broken) wrap(m metricsInterface.Metric, err error) (metricsInterface.Metric, error) {
+	if b.refuse {
+		return nil, errBroken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return brokenMetric{m}, nil
+}
+
+func (b *broken) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return b.wrap(b.Backend.NewCounter(name, help, labels))
+}
+
+func (b *broken) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return b.wrap(b.Backend.NewGauge(name, help, labels))
+}
+
+func (b *broken) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
+	return b.wrap(b.Backend.NewHistogram(name, help, labels, buckets))
+}
+
+func (b *broken) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	return b.wrap(b.Backend.NewSummary(name, help, labels, objectives, maxAge))
+}
+
+func (b *broken) Close() error {
+	b.closed = true
+	return errBroken
+}
+
+// tagging is a child backend that takes a unit and an NF type, like OTLP and
+// InfluxDB do.
+type tagging struct {
+	*metricstest.Backend
+	unit, nfType string
+}
+
+func (t *tagging) WithUnit(unit string) metricsInterface.Backend {
+	return &tagging{Backend: t.Backend, unit: unit, nfType: t.nfType}
+}
+
+func (t *tagging) WithNFType(nfType string) metricsInterface.Backend {
+	return &tagging{Backend: t.Backend, unit: t.unit, nfType: nfType}
+}
+
+func (t *tagging) NewUpDownCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return t.Backend.NewGauge(name, "up-down "+help, labels)
+}
+
+func newFanout(t *testing.T, children ...fanoutbackend.Child) *fanoutbackend.FanoutBackend {
+	t.Helper()
+
+	fb, err := fanoutbackend.NewFanoutBackend(children...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fb
+}
+
+func TestEveryChildUpdated(t *testing.T) {
+	a, b := metricstest.NewBackend(), metricstest.NewBackend()
+	fb := newFanout(t, fanoutbackend.Child{Name: "a", Backend: a}, fanoutbackend.Child{Name: "b", Backend: b})
+
+	gauge, err := fb.NewGauge("sessions", "Sessions", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	histogram, err := fb.NewHistogram("setup_time", "Setup time", nil, []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+	for _, err := range []error{gauge.Inc(slice1), gauge.Dec(slice1), gauge.Add(4, slice1), gauge.Set(2, slice1), histogram.Observe(0.5, nil)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(a.Calls()) != 5 || !reflect.DeepEqual(a.Calls(), b.Calls()) {
+		t.Errorf("children received\n%v\nand\n%v", a.Calls(), b.Calls())
+	}
+	if got, err := gauge.Value(slice1); err != nil || got.Value != 2 {
+		t.Errorf("Value() = %+v, %v, want 2 from the first child", got, err)
+	}
+	if !gauge.DeleteSeries(slice1) {
+		t.Error("DeleteSeries() found no series")
+	}
+	if series, _ := gauge.Series(); len(series) != 0 {
+		t.Errorf("series left after DeleteSeries: %v", series)
+	}
+}
+
+func TestWriteErrorsJoined(t *testing.T) {
+	a, b := metricstest.NewBackend(), metricstest.NewBackend()
+	fb := newFanout(t,
+		fanoutbackend.Child{Name: "a", Backend: a},
+		fanoutbackend.Child{Name: "datadog", Backend: &broken{Backend: metricstest.NewBackend()}},
+		fanoutbackend.Child{Name: "b", Backend: b})
+
+	counter, err := fb.NewCounter("registrations", "Registrations", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = counter.Inc(nil)
+	if !errors.Is(err, errBroken) || !strings.Contains(err.Error(), "datadog: agent unreachable") {
+		t.Errorf("Inc() = %v, want the datadog failure", err)
+	}
+	// The failing child does not keep the ones after it from being updated
+	for name, child := range map[string]*metricstest.Backend{"a": a, "b": b} {
+		if calls := child.CallsFor("registrations"); len(calls) != 1 || calls[0].Op != "Inc" {
+			t.Errorf("child %s received %v, want the Inc", name, calls)
+		}
+	}
+
+	// Errors from several children are all reported
+	err = counter.Dec(nil)
+	for _, want := range []string{"a: " + metricsInterface.ErrInvalidOperation.Error(), "datadog: agent unreachable", "b: " + metricsInterface.ErrInvalidOperation.Error()} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Dec() = %v, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestNewMetricFailsIfAnyChildFails(t *testing.T) {
+	a, b := metricstest.NewBackend(), metricstest.NewBackend()
+	fb := newFanout(t,
+		fanoutbackend.Child{Name: "a", Backend: a},
+		fanoutbackend.Child{Name: "otlp", Backend: &broken{Backend: metricstest.NewBackend(), refuse: true}},
+		fanoutbackend.Child{Name: "b", Backend: b})
+
+	for kind, create := range map[string]func() (metricsInterface.Metric, error){
+		"counter":   func() (metricsInterface.Metric, error) { return fb.NewCounter("m_counter", "", nil) },
+		"gauge":     func() (metricsInterface.Metric, error) { return fb.NewGauge("m_gauge", "", nil) },
+		"histogram": func() (metricsInterface.Metric, error) { return fb.NewHistogram("m_histogram", "", nil, nil) },
+		"summary":   func() (metricsInterface.Metric, error) { return fb.NewSummary("m_summary", "", nil, nil, 0) },
+	} {
+		m, err := create()
+		if m != nil || !errors.Is(err, errBroken) || !strings.HasPrefix(err.Error(), "otlp: ") {
+			t.Errorf("new %s = %v, %v, want the otlp failure", kind, m, err)
+		}
+	}
+	// The children that succeeded keep their metrics
+	if got := b.Metrics(); !reflect.DeepEqual(got, a.Metrics()) || len(got) != 4 {
+		t.Errorf("children created %v and %v, want all four metrics on both", a.Metrics(), got)
+	}
+}
+
+func TestUnitAndNFTypeOnlyForChildrenThatUseThem(t *testing.T) {
+	plain, tagged := metricstest.NewBackend(), &tagging{Backend: metricstest.NewBackend()}
+	fb := newFanout(t, fanoutbackend.Child{Name: "prometheus", Backend: plain}, fanoutbackend.Child{Name: "otlp", Backend: tagged})
+
+	view := fb.WithUnit("ms").(*fanoutbackend.FanoutBackend).WithNFType("AMF").(*fanoutbackend.FanoutBackend)
+	children := view.Children()
+	if children[0].Backend != plain {
+		t.Errorf("prometheus child became %T, want the backend itself", children[0].Backend)
+	}
+	if got, ok := children[1].Backend.(*tagging); !ok || got.unit != "ms" || got.nfType != "AMF" {
+		t.Errorf("otlp child %+v, want unit ms and NF type AMF", children[1].Backend)
+	}
+	if tagged.unit != "" || tagged.nfType != "" {
+		t.Error("the view changed the original child")
+	}
+
+	if _, err := view.NewUpDownCounter("sessions", "Sessions", nil); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := plain.Descriptor("sessions"); d.Type != metricsInterface.GaugeType || d.Help != "Sessions" {
+		t.Errorf("prometheus child created %+v, want a plain gauge", d)
+	}
+	if d, _ := tagged.Descriptor("sessions"); d.Help != "up-down Sessions" {
+		t.Errorf("otlp child created %+v, want an up-down counter", d)
+	}
+}
+
+func TestClose(t *testing.T) {
+	failing := &broken{Backend: metricstest.NewBackend()}
+	fb := newFanout(t, fanoutbackend.Child{Name: "prometheus", Backend: metricstest.NewBackend()}, fanoutbackend.Child{Name: "otlp", Backend: failing})
+
+	err := fb.Close()
+	if !failing.closed {
+		t.Error("Close() did not close the otlp child")
+	}
+	if !errors.Is(err, errBroken) || !strings.HasPrefix(err.Error(), "otlp: ") {
+		t.Errorf("Close() = %v, want the otlp failure", err)
+	}
+}
+
+func TestNoChildren(t *testing.T) {
+	if _, err := fanoutbackend.NewFanoutBackend(); err == nil {
+		t.Error("created a fan-out without children")
+	}
+}
@@ -0,0 +1,368 @@
+package influxbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// point renders one update of a metric as a line and buffers it. Tags are the
+// per-call labels plus the backend's constant tags.
+type point struct {
+	w         *writer
+	name      string
+	constTags map[string]string
+}
+
+func (p *point) write(labels map[string]string, fields ...field) {
+	tags := make(map[string]string, len(p.constTags)+len(labels))
+	maps.Copy(tags, p.constTags)
+	maps.Copy(tags, labels)
+
+	if line, ok := formatLine(p.name, tags, fields, time.Now()); ok {
+		p.w.add(line)
+	}
+}
+
+// writeValue returns the update callback writing the running value of the
+// series as the value field.
+func (p *point) writeValue(labels map[string]string) func(float64) {
+	return func(v float64) { p.write(labels, field{key: "value", value: v}) }
+}
+
+// InfluxCounter writes the running total of the series after every update.
+type InfluxCounter struct {
+	point
+	state *seriesState
+}
+
+func (ic *InfluxCounter) Inc(labels map[string]string) error {
+	return ic.Add(1, labels)
+}
+
+func (ic *InfluxCounter) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ic *InfluxCounter) Add(value float64, labels map[string]string) error {
+	if value < 0 {
+		return fmt.Errorf("%w: counter cannot decrease", metricsInterface.ErrInvalidOperation)
+	}
+	if err := checkTags(labels); err != nil {
+		return err
+	}
+	ic.state.update(labels, func(v float64) float64 { return v + value }, ic.writeValue(labels))
+	return nil
+}
+
+func (ic *InfluxCounter) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ic *InfluxCounter) Observe(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ic *InfluxCounter) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.CounterType
+}
+
+func (ic *InfluxCounter) DeleteSeries(labels map[string]string) bool {
+	return ic.state.delete(labels)
+}
+
+func (ic *InfluxCounter) DeletePartialMatch(labels map[string]string) int {
+	return ic.state.deletePartialMatch(labels)
+}
+
+func (ic *InfluxCounter) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return ic.state.value(labels)
+}
+
+func (ic *InfluxCounter) Series() ([]metricsInterface.Sample, error) {
+	return ic.state.series(), nil
+}
+
+// InfluxGauge writes the absolute value of the series after every update.
+type InfluxGauge struct {
+	point
+	state *seriesState
+}
+
+func (ig *InfluxGauge) Inc(labels map[string]string) error {
+	return ig.Add(1, labels)
+}
+
+func (ig *InfluxGauge) Dec(labels map[string]string) error {
+	return ig.Add(-1, labels)
+}
+
+func (ig *InfluxGauge) Add(value float64, labels map[string]string) error {
+	if err := checkTags(labels); err != nil {
+		return err
+	}
+	ig.state.update(labels, func(v float64) float64 { return v + value }, ig.writeValue(labels))
+	return nil
+}
+
+func (ig *InfluxGauge) Set(value float64, labels map[string]string) error {
+	if err := checkTags(labels); err != nil {
+		return err
+	}
+	ig.state.update(labels, func(float64) float64 { return value }, ig.writeValue(labels))
+	return nil
+}
+
+func (ig *InfluxGauge) Observe(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ig *InfluxGauge) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.GaugeType
+}
+
+func (ig *InfluxGauge) DeleteSeries(labels map[string]string) bool {
+	return ig.state.delete(labels)
+}
+
+func (ig *InfluxGauge) DeletePartialMatch(labels map[string]string) int {
+	return ig.state.deletePartialMatch(labels)
+}
+
+func (ig *InfluxGauge) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return ig.state.value(labels)
+}
+
+func (ig *InfluxGauge) Series() ([]metricsInterface.Sample, error) {
+	return ig.state.series(), nil
+}
+
+// InfluxObservations writes every observation of a histogram or summary as a
+// point of its own, so quantiles and buckets are computed in Influx.
+type InfluxObservations struct {
+	point
+	state      *seriesState
+	metricType metricsInterface.MetricType
+}
+
+func (ob *InfluxObservations) Inc(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ob *InfluxObservations) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ob *InfluxObservations) Add(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ob *InfluxObservations) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ob *InfluxObservations) Observe(value float64, labels map[string]string) error {
+	if err := checkTags(labels); err != nil {
+		return err
+	}
+	ob.state.observe(labels, value)
+	ob.write(labels, field{key: "value", value: value})
+	return nil
+}
+
+func (ob *InfluxObservations) GetMetricType() metricsInterface.MetricType {
+	return ob.metricType
+}
+
+func (ob *InfluxObservations) DeleteSeries(labels map[string]string) bool {
+	return ob.state.delete(labels)
+}
+
+func (ob *InfluxObservations) DeletePartialMatch(labels map[string]string) int {
+	return ob.state.deletePartialMatch(labels)
+}
+
+func (ob *InfluxObservations) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return ob.state.value(labels)
+}
+
+func (ob *InfluxObservations) Series() ([]metricsInterface.Sample, error) {
+	return ob.state.series(), nil
+}
+
+const (
+	TransportHTTP = "http"
+	TransportUDP  = "udp"
+
+	DefaultUDPAddress    = "localhost:8089"
+	DefaultBatchSize     = 5000
+	DefaultFlushInterval = 10 * time.Second
+	DefaultTimeout       = 10 * time.Second
+	DefaultMaxPacketSize = 1400
+
+	// NFTypeTag is the tag carrying the KPI nf_type.
+	NFTypeTag = "nf_type"
+)
+
+// Config describes where line protocol is written. For HTTP, Address is the
+// full write URL, e.g. http://influxdb:8086/api/v2/write?org=lab&bucket=kpis
+// or a Telegraf http_listener_v2; for UDP it is host:port of an InfluxDB or
+// Telegraf UDP listener. Token (InfluxDB 2) or Username/Password authenticate
+// HTTP writes. MaxPending bounds the buffered points. Zero values take the
+// defaults.
+type Config struct {
+	Address       string
+	Transport     string
+	Token         string
+	Username      string
+	Password      string
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	MaxPending    int
+	MaxPacketSize int
+}
+
+func (c Config) withDefaults() (Config, error) {
+	c.Transport = strings.ToLower(c.Transport)
+	switch c.Transport {
+	case "", TransportHTTP:
+		c.Transport = TransportHTTP
+		if c.Address == "" {
+			return c, errors.New("influx write URL is required")
+		}
+	case TransportUDP:
+		if c.Address == "" {
+			c.Address = DefaultUDPAddress
+		}
+	default:
+		return c, fmt.Errorf("unsupported influx transport %q", c.Transport)
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.MaxPending <= 0 {
+		c.MaxPending = 10 * c.BatchSize
+	}
+	if c.MaxPacketSize <= 0 {
+		c.MaxPacketSize = DefaultMaxPacketSize
+	}
+	return c, nil
+}
+
+type InfluxBackend struct {
+	w         *writer
+	constTags map[string]string
+}
+
+func NewInfluxBackend(cfg Config) (*InfluxBackend, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newWriter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &InfluxBackend{w: w}, nil
+}
+
+// WithConstLabels returns a view of the backend whose points carry labels as
+// tags, keeping the NF type tag of the view.
+func (ib *InfluxBackend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	tags := maps.Clone(labels)
+	if nfType, ok := ib.constTags[NFTypeTag]; ok {
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[NFTypeTag] = nfType
+	}
+	return &InfluxBackend{w: ib.w, constTags: tags}
+}
+
+// WithNFType returns a view of the backend whose points carry the nf_type tag.
+func (ib *InfluxBackend) WithNFType(nfType string) metricsInterface.Backend {
+	tags := maps.Clone(ib.constTags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags[NFTypeTag] = nfType
+	return &InfluxBackend{w: ib.w, constTags: tags}
+}
+
+// newPoint checks the names every point of a metric carries. An object
+// label called nf_type is rejected when the NF type is tagged, as it would
+// silently replace the tag.
+func (ib *InfluxBackend) newPoint(name string, labels []string) (point, error) {
+	if err := checkNames(append([]string{name}, labels...)...); err != nil {
+		return point{}, err
+	}
+	if err := checkTags(ib.constTags); err != nil {
+		return point{}, err
+	}
+	if _, tagged := ib.constTags[NFTypeTag]; tagged && slices.Contains(labels, NFTypeTag) {
+		return point{}, fmt.Errorf("%w: label %s of %s clashes with the NF type tag",
+			metricsInterface.ErrInvalidLabel, NFTypeTag, name)
+	}
+	return point{w: ib.w, name: name, constTags: ib.constTags}, nil
+}
+
+func (ib *InfluxBackend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	p, err := ib.newPoint(name, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &InfluxCounter{point: p, state: newSeriesState()}, nil
+}
+
+func (ib *InfluxBackend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
+	p, err := ib.newPoint(name, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &InfluxGauge{point: p, state: newSeriesState()}, nil
+}
+
+func (ib *InfluxBackend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
+	p, err := ib.newPoint(name, labels)
+	if err != nil {
+		return nil, err
+	}
+	// Raw observations are written; buckets are applied by the queries
+	return &InfluxObservations{point: p, state: newObservationState(),
+		metricType: metricsInterface.HistogramType}, nil
+}
+
+func (ib *InfluxBackend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	p, err := ib.newPoint(name, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &InfluxObservations{point: p, state: newObservationState(),
+		metricType: metricsInterface.SummaryType}, nil
+}
+
+// PushToGateway writes the buffered points now; the gateway URL and job name
+// are not used.
+func (ib *InfluxBackend) PushToGateway(gatewayURL, jobName string) error {
+	if err := ib.w.flush(); err != nil {
+		return fmt.Errorf("influx flush failed: %w", err)
+	}
+	return nil
+}
+
+// Close writes the buffered points and stops the flush loop.
+func (ib *InfluxBackend) Close() error {
+	return ib.w.close()
+}
@@ -0,0 +1,298 @@
+package influxbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a line-protocol write endpoint answering with the queued
+// status codes, then 204, and keeping the lines it accepted.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	auth     string
+	lines    []string
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.requests++
+		r.auth = req.Header.Get("Authorization")
+		if len(r.statuses) > 0 {
+			status := r.statuses[0]
+			r.statuses = r.statuses[1:]
+			http.Error(w, "rejected", status)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.lines = append(r.lines, withoutTimestamps(string(body))...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *receiver) result() (int, string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests, r.auth, r.lines
+}
+
+// withoutTimestamps splits a body into lines and drops the timestamp of each.
+func withoutTimestamps(body string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		lines = append(lines, line[:strings.LastIndexByte(line, ' ')])
+	}
+	return lines
+}
+
+func newTestBackend(t *testing.T, cfg Config) *InfluxBackend {
+	t.Helper()
+
+	cfg.FlushInterval = time.Hour
+	ib, err := NewInfluxBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ib.Close() })
+	return ib
+}
+
+func TestHTTPWrite(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	ib := newTestBackend(t, Config{Address: srv.URL, Token: "token1"})
+	amf := ib.WithNFType("AMF").WithConstLabels(map[string]string{"site": "lab 1"})
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+
+	counter, err := amf.NewCounter("registrations", "", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gauge, err := amf.NewGauge("active_sessions", "", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	histogram, err := amf.NewHistogram("setup_time", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter.Inc(slice1)
+	counter.Add(2, slice1)
+	gauge.Inc(slice1)
+	gauge.Set(5, slice1)
+	gauge.Set(math.NaN(), slice1) // not written
+	histogram.Observe(0.25, nil)
+	if err := ib.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	requests, auth, lines := rcv.result()
+	if requests != 1 || auth != "Token token1" {
+		t.Errorf("got %d requests with Authorization %q", requests, auth)
+	}
+	want := []string{
+		`registrations,NetworkSlice=slice1,nf_type=AMF,site=lab\ 1 value=1`,
+		`registrations,NetworkSlice=slice1,nf_type=AMF,site=lab\ 1 value=3`,
+		`active_sessions,NetworkSlice=slice1,nf_type=AMF,site=lab\ 1 value=1`,
+		`active_sessions,NetworkSlice=slice1,nf_type=AMF,site=lab\ 1 value=5`,
+		`setup_time,nf_type=AMF,site=lab\ 1 value=0.25`,
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("received\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHTTPWriteBatches(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	ib := newTestBackend(t, Config{Address: srv.URL, BatchSize: 2})
+	gauge, err := ib.NewGauge("cpu_load", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		gauge.Set(float64(i), nil)
+	}
+	if err := ib.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if requests, _, lines := rcv.result(); requests != 2 || len(lines) != 3 {
+		t.Errorf("got %d requests with %d lines, want 2 and 3", requests, len(lines))
+	}
+}
+
+func TestHTTPWriteFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantErr   bool
+		wantLines int
+	}{
+		// The batch stays buffered and goes out with the next flush
+		{"server error kept", http.StatusServiceUnavailable, true, 1},
+		{"rate limit kept", http.StatusTooManyRequests, true, 1},
+		// Resending a rejected batch cannot succeed
+		{"rejected batch dropped", http.StatusBadRequest, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv, srv := newReceiver(t, tt.status)
+			ib := newTestBackend(t, Config{Address: srv.URL})
+			gauge, err := ib.NewGauge("cpu_load", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gauge.Set(1, nil)
+
+			if err := ib.PushToGateway("", ""); (err != nil) != tt.wantErr {
+				t.Errorf("first PushToGateway() = %v, want error %v", err, tt.wantErr)
+			}
+			if err := ib.PushToGateway("", ""); err != nil {
+				t.Errorf("second PushToGateway() = %v", err)
+			}
+			if _, _, lines := rcv.result(); len(lines) != tt.wantLines {
+				t.Errorf("received %d lines, want %d", len(lines), tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestUDPWrite(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Room for two of the 46-byte lines per datagram
+	ib := newTestBackend(t, Config{Address: conn.LocalAddr().String(), Transport: TransportUDP, MaxPacketSize: 100})
+	gauge, err := ib.NewGauge("cpu_load", "", []string{"core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, core := range []string{"0", "1", "2"} {
+		gauge.Set(0.5, map[string]string{"core": core})
+	}
+	if err := ib.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var datagrams [][]string
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(datagrams) < 2 {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %d datagrams: %v", len(datagrams), err)
+		}
+		datagrams = append(datagrams, withoutTimestamps(string(buf[:n])))
+	}
+
+	want := [][]string{
+		{"cpu_load,core=0 value=0.5", "cpu_load,core=1 value=0.5"},
+		{"cpu_load,core=2 value=0.5"},
+	}
+	for i := range want {
+		if !slices.Equal(datagrams[i], want[i]) {
+			t.Errorf("datagram %d = %q, want %q", i, datagrams[i], want[i])
+		}
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	_, srv := newReceiver(t)
+	ib := newTestBackend(t, Config{Address: srv.URL})
+	amf := ib.WithNFType("AMF")
+
+	if _, err := amf.NewCounter("registrations", "", []string{NFTypeTag}); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("nf_type label with the NF type tagged: got %v, want ErrInvalidLabel", err)
+	}
+	if _, err := ib.NewCounter("registrations", "", []string{NFTypeTag}); err != nil {
+		t.Errorf("nf_type label without the NF type tag: %v", err)
+	}
+	if _, err := ib.NewCounter("regis\ntrations", "", nil); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("line break in the name: got %v, want ErrInvalidLabel", err)
+	}
+	if _, err := ib.WithConstLabels(map[string]string{"site": "a\nb"}).NewGauge("cpu_load", "", nil); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("line break in a constant label: got %v, want ErrInvalidLabel", err)
+	}
+
+	gauge, err := ib.NewGauge("cpu_load", "", []string{"core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gauge.Set(1, map[string]string{"core": "0\n1"}); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("line break in a label value: got %v, want ErrInvalidLabel", err)
+	}
+	if series, _ := gauge.Series(); len(series) != 0 {
+		t.Errorf("rejected write kept a series: %v", series)
+	}
+}
+
+func TestConcurrentCounterUpdates(t *testing.T) {
+	_, srv := newReceiver(t)
+	ib := newTestBackend(t, Config{Address: srv.URL})
+	counter, err := ib.NewCounter("registrations", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, updates = 8, 200
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				counter.Inc(nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ib.w.mu.Lock()
+	lines := slices.Clone(ib.w.pending)
+	ib.w.mu.Unlock()
+
+	// Every point carries a larger total and no earlier timestamp than the
+	// one before it, so the last point is the final total
+	if len(lines) != workers*updates {
+		t.Fatalf("buffered %d points, want %d", len(lines), workers*updates)
+	}
+	var lastTotal float64
+	var lastTS int64
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		total, err := strconv.ParseFloat(strings.TrimPrefix(fields[1], "value="), 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != lastTotal+1 || ts < lastTS {
+			t.Fatalf("point %q follows total %v at %d", line, lastTotal, lastTS)
+		}
+		lastTotal, lastTS = total, ts
+	}
+}
@@ -0,0 +1,88 @@
+package influxbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// field is one field of a point.
+type field struct {
+	key   string
+	value float64
+}
+
+// checkNames rejects measurement names, tag keys and tag values containing
+// line breaks: line protocol has no escape for them, as a newline ends the
+// point.
+func checkNames(names ...string) error {
+	for _, name := range names {
+		if strings.ContainsAny(name, "\r\n") {
+			return fmt.Errorf("%w: %q contains a line break", metricsInterface.ErrInvalidLabel, name)
+		}
+	}
+	return nil
+}
+
+// checkTags is checkNames for every key and value of tags.
+func checkTags(tags map[string]string) error {
+	for k, v := range tags {
+		if err := checkNames(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLine renders one point of line protocol:
+//
+//	measurement,tag=value,... field=value,... timestamp
+//
+// Tags are sorted by key and tags with empty values are left out, as Influx
+// rejects them. ok is false for values line protocol cannot carry (NaN, Inf);
+// names are checked for line breaks beforehand.
+func formatLine(measurement string, tags map[string]string, fields []field, ts time.Time) (string, bool) {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(tags[k]))
+	}
+
+	for i, f := range fields {
+		if math.IsNaN(f.value) || math.IsInf(f.value, 0) {
+			return "", false
+		}
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(f.key))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(f.value, 'f', -1, 64))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+	return b.String(), true
+}
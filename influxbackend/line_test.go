@@ -0,0 +1,70 @@
+package influxbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatLine(t *testing.T) {
+	ts := time.Unix(1700000000, 5)
+	value := []field{{key: "value", value: 3}}
+
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      []field
+		want        string
+	}{
+		{"plain", "registrations", nil, value, "registrations value=3 1700000000000000005"},
+		{"sorted tags", "registrations", map[string]string{"nf_type": "AMF", "NetworkSlice": "slice1"}, value,
+			"registrations,NetworkSlice=slice1,nf_type=AMF value=3 1700000000000000005"},
+		{"empty tag left out", "registrations", map[string]string{"Cause": "", "nf_type": "AMF"}, value,
+			"registrations,nf_type=AMF value=3 1700000000000000005"},
+		{"measurement escaping", "Registered UEs,total", nil, value, `Registered\ UEs\,total value=3 1700000000000000005`},
+		// = needs no escape in a measurement
+		{"equals in measurement", "a=b", nil, value, "a=b value=3 1700000000000000005"},
+		{"tag escaping", "m", map[string]string{"Slice id": "a=1,b 2"}, value, `m,Slice\ id=a\=1\,b\ 2 value=3 1700000000000000005`},
+		{"field escaping", "m", nil, []field{{key: "a b", value: 1}, {key: "c=d", value: 2}},
+			`m a\ b=1,c\=d=2 1700000000000000005`},
+		{"float formatting", "m", nil, []field{{key: "value", value: 0.000001}}, "m value=0.000001 1700000000000000005"},
+		{"large value", "m", nil, []field{{key: "value", value: 1e21}}, "m value=1000000000000000000000 1700000000000000005"},
+		{"negative value", "m", nil, []field{{key: "value", value: -2.5}}, "m value=-2.5 1700000000000000005"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := formatLine(tt.measurement, tt.tags, tt.fields, ts)
+			if !ok || got != tt.want {
+				t.Errorf("formatLine() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatLineNonFinite(t *testing.T) {
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if line, ok := formatLine("m", nil, []field{{key: "value", value: v}}, time.Now()); ok {
+			t.Errorf("formatLine(%v) = %q, want no line", v, line)
+		}
+	}
+}
+
+func TestCheckNames(t *testing.T) {
+	if err := checkNames("Registered UEs", "a,b=c"); err != nil {
+		t.Errorf("checkNames() = %v for names line protocol can escape", err)
+	}
+	for _, name := range []string{"a\nb", "a\rb", "\n"} {
+		if err := checkNames("ok", name); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+			t.Errorf("checkNames(%q) = %v, want ErrInvalidLabel", name, err)
+		}
+	}
+	if err := checkTags(map[string]string{"Cause": "a\nb"}); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("checkTags() with a line break in a value = %v, want ErrInvalidLabel", err)
+	}
+	if err := checkTags(map[string]string{"Ca\nuse": "a"}); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("checkTags() with a line break in a key = %v, want ErrInvalidLabel", err)
+	}
+}
@@ -0,0 +1,201 @@
+package influxbackend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writer buffers lines and writes them in batches: when BatchSize lines are
+// waiting, every FlushInterval, and on flush. Lines that fail to send go back
+// to the front of the buffer for the next attempt; beyond MaxPending lines
+// the oldest are dropped.
+type writer struct {
+	cfg    Config
+	client *http.Client
+	conn   net.Conn
+
+	mu      sync.Mutex
+	pending []string
+
+	sendMu sync.Mutex
+	kick   chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+func newWriter(cfg Config) (*writer, error) {
+	w := &writer{
+		cfg:  cfg,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+
+	switch cfg.Transport {
+	case TransportHTTP:
+		w.client = &http.Client{Timeout: cfg.Timeout}
+	case TransportUDP:
+		conn, err := net.Dial("udp", cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+		}
+		w.conn = conn
+	}
+
+	w.wg.Add(1)
+	go w.loop()
+	return w, nil
+}
+
+func (w *writer) loop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		case <-w.kick:
+		}
+		if err := w.flush(); err != nil {
+			log.Printf("Influx write failed: %v", err)
+		}
+	}
+}
+
+func (w *writer) add(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, line)
+	if over := len(w.pending) - w.cfg.MaxPending; over > 0 {
+		log.Printf("Influx buffer full, dropping %d points", over)
+		w.pending = w.pending[over:]
+	}
+	if len(w.pending) >= w.cfg.BatchSize {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush writes everything buffered so far.
+func (w *writer) flush() error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	lines := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	for start := 0; start < len(lines); start += w.cfg.BatchSize {
+		batch := lines[start:min(start+w.cfg.BatchSize, len(lines))]
+		if err := w.send(batch); err != nil {
+			w.requeue(lines[start:])
+			return err
+		}
+	}
+	return nil
+}
+
+// requeue puts unsent lines back in front of those added meanwhile.
+func (w *writer) requeue(lines []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(append([]string(nil), lines...), w.pending...)
+	if over := len(w.pending) - w.cfg.MaxPending; over > 0 {
+		log.Printf("Influx buffer full, dropping %d points", over)
+		w.pending = w.pending[over:]
+	}
+}
+
+func (w *writer) send(lines []string) error {
+	if w.conn != nil {
+		return w.sendUDP(lines)
+	}
+	return w.sendHTTP(lines)
+}
+
+func (w *writer) sendHTTP(lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequest(http.MethodPost, w.cfg.Address, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case w.cfg.Token != "":
+		req.Header.Set("Authorization", "Token "+w.cfg.Token)
+	case w.cfg.Username != "":
+		req.SetBasicAuth(w.cfg.Username, w.cfg.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	err = fmt.Errorf("influx write returned %s", resp.Status)
+	if msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256)); len(bytes.TrimSpace(msg)) > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(msg))
+	}
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		// Resending a rejected batch cannot succeed
+		log.Printf("Dropping %d points rejected by Influx: %v", len(lines), err)
+		return nil
+	}
+	return err
+}
+
+// sendUDP packs the lines into datagrams of at most MaxPacketSize bytes.
+func (w *writer) sendUDP(lines []string) error {
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+len(line)+1 > w.cfg.MaxPacketSize {
+			if _, err := w.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+		packet = append(packet, '\n')
+	}
+	if len(packet) > 0 {
+		if _, err := w.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close writes what is buffered and stops the flush loop.
+func (w *writer) close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.stop)
+		w.wg.Wait()
+		err = w.flush()
+		if w.conn != nil {
+			err = errors.Join(err, w.conn.Close())
+		}
+	})
+	return err
+}
@@ -3,15 +3,22 @@ package main
 /*
 #include <stdlib.h>
 #include <stdio.h>
+
+#define AMANTYA_OK                     0
+#define AMANTYA_ERR                   -1
+#define AMANTYA_ERR_NOT_FOUND         -2
+#define AMANTYA_ERR_NOT_PERMITTED     -3
+#define AMANTYA_ERR_INVALID_OPERATION -4
+#define AMANTYA_ERR_INVALID_LABEL     -5
+#define AMANTYA_ERR_CARDINALITY       -6
 */
 import "C"
 import (
 	"amantya_metrics/metricsInterface"
 	"amantya_metrics/metrics_wrapper"
-	"amantya_metrics/models"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"unsafe"
 )
 
@@ -19,6 +26,18 @@ var framework *metrics_wrapper.MetricsFramework
 
 //export Initialize
 func Initialize(backendType *C.char, namespace *C.char) C.int {
+	return initialize(backendType, namespace, nil)
+}
+
+// InitializeWithLabels is Initialize plus constant labels (key/value pairs,
+// as for IncrementMetric) attached to every metric, e.g. nf_instance_id.
+//
+//export InitializeWithLabels
+func InitializeWithLabels(backendType *C.char, namespace *C.char, constLabels **C.char, count C.int) C.int {
+	return initialize(backendType, namespace, toLabelMap(constLabels, count))
+}
+
+func initialize(backendType *C.char, namespace *C.char, constLabels map[string]string) C.int {
 	if backendType != nil {
 		fmt.Println("Backend:", C.GoString(backendType))
 	}
@@ -30,6 +49,9 @@ func Initialize(backendType *C.char, namespace *C.char) C.int {
 	if namespace != nil {
 		options["namespace"] = C.GoString(namespace)
 	}
+	if len(constLabels) > 0 {
+		options[metrics_wrapper.OptConstLabels] = constLabels
+	}
 
 	f, err := metrics_wrapper.MetricsType(metrics_wrapper.BackendType(C.GoString(backendType)), options)
 	if err != nil {
@@ -66,98 +88,59 @@ func RegisterMetrics() C.int {
 	return 0
 }
 
-//export IncrementMetric
-func IncrementMetric(metricName *C.char, labels **C.char, count C.int) C.int {
+// toLabelMap converts a flat C array of key/value strings into a label map.
+// A NULL array or a non-positive count yields an empty map.
+func toLabelMap(labels **C.char, count C.int) map[string]string {
 	goLabels := make(map[string]string)
-
-	// Convert C array of strings to Go map
-	if labels != nil && count > 0 {
-		cLabels := (*[1 << 30]*C.char)(unsafe.Pointer(labels))[:count:count]
-		for i := 0; i < int(count); i += 2 {
-			if i+1 >= int(count) {
-				break
-			}
-			key := C.GoString(cLabels[i])
-			value := C.GoString(cLabels[i+1])
-			goLabels[key] = value
-		}
+	if labels == nil || count <= 0 {
+		return goLabels
 	}
 
-	// Normalize metric name
-	normalizedName := normalizeMetricName(C.GoString(metricName))
-
-	// Get the metric
-	metric, err := framework.GetMetric(normalizedName)
-	if err != nil {
-		log.Printf("Metric not found: %s (normalized from: %s)", normalizedName, C.GoString(metricName))
-		return -1
+	cLabels := (*[1 << 30]*C.char)(unsafe.Pointer(labels))[:count:count]
+	for i := 0; i+1 < int(count); i += 2 {
+		goLabels[C.GoString(cLabels[i])] = C.GoString(cLabels[i+1])
 	}
+	return goLabels
+}
 
-	// Validate labels against KPI requirements
-	if err := validateLabels(normalizedName, goLabels); err != nil {
-		log.Printf("Label validation failed for %s: %v", normalizedName, err)
-		return -1
-	}
+//export IncrementMetric
+func IncrementMetric(metricName *C.char, labels **C.char, count C.int) C.int {
+	goLabels := toLabelMap(labels, count)
 
-	if err := metric.Inc(goLabels); err != nil {
-		log.Printf("Increment failed for %s: %v", normalizedName, err)
-		return -1
+	if err := framework.IncrementMetric(C.GoString(metricName), goLabels); err != nil {
+		log.Printf("IncrementMetric failed: %v", err)
+		return errorCode(err)
 	}
 
 	return 0
 }
 
-func validateLabels(metricName string, labels map[string]string) error {
-	// Get KPIs through the public method
-	kpis := framework.GetKPIs()
-
-	// Find the KPI definition
-	var kpi *models.KPI
-	for _, k := range kpis {
-		if normalizeMetricName(k.DisplayName) == metricName {
-			kpi = &k
-			break
-		}
-	}
-	if kpi == nil {
-		return fmt.Errorf("KPI definition not found")
+// errorCode maps framework errors onto the AMANTYA_ERR_* codes.
+func errorCode(err error) C.int {
+	switch {
+	case errors.Is(err, metricsInterface.ErrMetricNotFound),
+		errors.Is(err, metricsInterface.ErrSeriesNotFound):
+		return C.AMANTYA_ERR_NOT_FOUND
+	case errors.Is(err, metricsInterface.ErrOperationNotPermitted):
+		return C.AMANTYA_ERR_NOT_PERMITTED
+	case errors.Is(err, metricsInterface.ErrInvalidOperation):
+		return C.AMANTYA_ERR_INVALID_OPERATION
+	case errors.Is(err, metricsInterface.ErrInvalidLabel):
+		return C.AMANTYA_ERR_INVALID_LABEL
+	case errors.Is(err, metricsInterface.ErrCardinalityExceeded):
+		return C.AMANTYA_ERR_CARDINALITY
+	default:
+		return C.AMANTYA_ERR
 	}
-
-	// Check required labels
-	for _, requiredLabel := range kpi.Object {
-		if _, exists := labels[requiredLabel]; !exists {
-			return fmt.Errorf("missing required label: %s", requiredLabel)
-		}
-	}
-
-	return nil
-}
-
-func normalizeMetricName(displayName string) string {
-	name := strings.ToLower(displayName)
-	name = strings.ReplaceAll(name, " ", "_")
-	name = strings.ReplaceAll(name, "-", "_")
-	name = strings.ReplaceAll(name, "(", "")
-	name = strings.ReplaceAll(name, ")", "")
-	return name
 }
 
 //export DecrementMetric
 func DecrementMetric(metricName *C.char, labels **C.char, count C.int) C.int {
-	goLabels := make(map[string]string)
-	cLabels := (*[1 << 30]*C.char)(unsafe.Pointer(labels))[:count:count]
-
-	for i := 0; i < int(count); i += 2 {
-		if i+1 >= int(count) {
-			break
-		}
-		key := C.GoString(cLabels[i])
-		value := C.GoString(cLabels[i+1])
-		goLabels[key] = value
-	}
+	goLabels := toLabelMap(labels, count)
 
 	if err := framework.DecrementMetric(C.GoString(metricName), goLabels); err != nil {
-		return -1
+		log.Printf("DecrementMetric failed: %v", err)
+		return errorCode(err)
 	}
 
 	return 0
@@ -165,20 +148,11 @@ func DecrementMetric(metricName *C.char, labels **C.char, count C.int) C.int {
 
 //export AddToMetric
 func AddToMetric(metricName *C.char, value C.double, labels **C.char, count C.int) C.int {
-	goLabels := make(map[string]string)
-	cLabels := (*[1 << 30]*C.char)(unsafe.Pointer(labels))[:count:count]
-
-	for i := 0; i < int(count); i += 2 {
-		if i+1 >= int(count) {
-			break
-		}
-		key := C.GoString(cLabels[i])
-		value := C.GoString(cLabels[i+1])
-		goLabels[key] = value
-	}
+	goLabels := toLabelMap(labels, count)
 
 	if err := framework.AddToMetric(C.GoString(metricName), float64(value), goLabels); err != nil {
-		return -1
+		log.Printf("AddToMetric failed: %v", err)
+		return errorCode(err)
 	}
 
 	return 0
@@ -186,45 +160,79 @@ func AddToMetric(metricName *C.char, value C.double, labels **C.char, count C.in
 
 //export SetMetric
 func SetMetric(metricName *C.char, value C.double, labels **C.char, count C.int) C.int {
-	// Convert C inputs to Go types
+	goLabels := toLabelMap(labels, count)
+
+	if err := framework.SetMetric(C.GoString(metricName), float64(value), goLabels); err != nil {
+		log.Printf("SetMetric failed: %v", err)
+		return errorCode(err)
+	}
+
+	return 0
+}
+
+//export ObserveMetric
+func ObserveMetric(metricName *C.char, value C.double, labels **C.char, count C.int) C.int {
 	name := C.GoString(metricName)
-	goLabels := make(map[string]string)
+	goLabels := toLabelMap(labels, count)
 
-	// Process labels if provided
-	if labels != nil && count > 0 {
-		cLabels := (*[1 << 30]*C.char)(unsafe.Pointer(labels))[:count:count]
-		for i := 0; i < int(count); i += 2 {
-			if i+1 >= int(count) {
-				break
-			}
-			key := C.GoString(cLabels[i])
-			value := C.GoString(cLabels[i+1])
-			goLabels[key] = value
-		}
+	if err := framework.ObserveMetric(name, float64(value), goLabels); err != nil {
+		log.Printf("ObserveMetric failed for %s: %v", name, err)
+		return errorCode(err)
 	}
 
-	// Get the metric
-	metric, err := framework.GetMetric(name)
+	return 0
+}
+
+// GetMetricValue stores the current value of one series in *value. For
+// histograms and summaries that is the sum of the observations.
+//
+//export GetMetricValue
+func GetMetricValue(metricName *C.char, labels **C.char, count C.int, value *C.double) C.int {
+	name := C.GoString(metricName)
+
+	sample, err := framework.GetMetricValue(name, toLabelMap(labels, count))
 	if err != nil {
-		log.Printf("SetMetric failed: %v", err)
-		return -1
+		log.Printf("GetMetricValue failed for %s: %v", name, err)
+		return errorCode(err)
 	}
 
-	// Check if metric supports Set operation
-	if metric.GetMetricType() == metricsInterface.CounterType {
-		log.Printf("Set operation not supported for Counter metric: %s", name)
-		return -1
+	if value != nil {
+		*value = C.double(sample.Value)
+		if sample.Count > 0 {
+			*value = C.double(sample.Sum)
+		}
 	}
+	return 0
+}
 
-	// Perform the set operation
-	if err := metric.Set(float64(value), goLabels); err != nil {
-		log.Printf("SetMetric failed: %v", err)
-		return -1
+//export DeleteSeries
+func DeleteSeries(metricName *C.char, labels **C.char, count C.int) C.int {
+	name := C.GoString(metricName)
+
+	if err := framework.DeleteSeries(name, toLabelMap(labels, count)); err != nil {
+		log.Printf("DeleteSeries failed for %s: %v", name, err)
+		return errorCode(err)
 	}
 
 	return 0
 }
 
+// DeletePartialMatch returns the number of series removed, or a negative
+// AMANTYA_ERR_* code.
+//
+//export DeletePartialMatch
+func DeletePartialMatch(metricName *C.char, labels **C.char, count C.int) C.int {
+	name := C.GoString(metricName)
+
+	deleted, err := framework.DeletePartialMatch(name, toLabelMap(labels, count))
+	if err != nil {
+		log.Printf("DeletePartialMatch failed for %s: %v", name, err)
+		return errorCode(err)
+	}
+
+	return C.int(deleted)
+}
+
 //export PushMetrics
 func PushMetrics(gatewayURL *C.char, jobName *C.char) C.int {
 	if err := framework.PushMetrics(C.GoString(gatewayURL), C.GoString(jobName)); err != nil {
@@ -0,0 +1,69 @@
+package metricsInterface
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CheckLabels verifies that labels carries exactly the expected label names.
+// A mismatch is reported as ErrInvalidLabel naming the missing and extra labels.
+func CheckLabels(expected []string, labels map[string]string) error {
+	var missing, extra []string
+
+	want := make(map[string]bool, len(expected))
+	for _, name := range expected {
+		want[name] = true
+		if _, ok := labels[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	for name := range labels {
+		if !want[name] {
+			extra = append(extra, name)
+		}
+	}
+
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+
+	sort.Strings(extra)
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		parts = append(parts, "unexpected "+strings.Join(extra, ", "))
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidLabel, strings.Join(parts, "; "))
+}
+
+// SeriesKey returns a stable identifier for a label set, independent of map
+// iteration order.
+func SeriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// MatchesLabels reports whether labels contains every name/value pair of subset.
+func MatchesLabels(labels, subset map[string]string) bool {
+	for k, v := range subset {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
@@ -1,19 +1,60 @@
 package metricsInterface
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+	"time"
+)
 
 type MetricType string
 
 const (
-	CounterType MetricType = "Counter"
-	GaugeType   MetricType = "Gauge"
+	CounterType   MetricType = "Counter"
+	GaugeType     MetricType = "Gauge"
+	HistogramType MetricType = "Histogram"
+	SummaryType   MetricType = "Summary"
 )
 
 type Backend interface {
 	NewCounter(name, help string, labels []string) (Metric, error)
 	NewGauge(name, help string, labels []string) (Metric, error)
 	NewHistogram(name, help string, labels []string, buckets []float64) (Metric, error)
+	NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (Metric, error)
 	PushToGateway(gatewayURL, jobName string) error
+	// WithConstLabels returns a backend that attaches the given constant
+	// labels to every metric it creates, on top of the per-call labels.
+	WithConstLabels(labels map[string]string) Backend
+}
+
+// ScrapeBackend is implemented by backends that can serve their metrics over
+// HTTP for a pull-based collector.
+type ScrapeBackend interface {
+	Handler() http.Handler
+}
+
+// InstrumentBackend is implemented by backends whose instruments carry more
+// of the KPI definition than Prometheus metrics do, such as OTLP.
+type InstrumentBackend interface {
+	// WithUnit returns a view of the backend whose metrics carry the unit.
+	WithUnit(unit string) Backend
+	// NewUpDownCounter creates a gauge that is only moved by increments and
+	// decrements, so its series can be summed.
+	NewUpDownCounter(name, help string, labels []string) (Metric, error)
+}
+
+// TaggingBackend is implemented by backends that tag every data point with
+// the NF type of its KPI, such as InfluxDB.
+type TaggingBackend interface {
+	WithNFType(nfType string) Backend
+}
+
+// Sample is the current state of one series. Counters and gauges report
+// Value; histograms and summaries report the number and sum of observations.
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+	Count  uint64            `json:"count,omitempty"`
+	Sum    float64           `json:"sum,omitempty"`
 }
 
 type Metric interface {
@@ -23,6 +64,17 @@ type Metric interface {
 	Set(value float64, labels map[string]string) error
 	Observe(value float64, labels map[string]string) error
 	GetMetricType() MetricType
+	// DeleteSeries removes the series with exactly these labels and reports
+	// whether it existed.
+	DeleteSeries(labels map[string]string) bool
+	// DeletePartialMatch removes every series whose labels include the given
+	// ones and returns how many were removed.
+	DeletePartialMatch(labels map[string]string) int
+	// Value returns the series with exactly these labels, or
+	// ErrSeriesNotFound if it has not been written.
+	Value(labels map[string]string) (Sample, error)
+	// Series returns every series of the metric, ordered by label set.
+	Series() ([]Sample, error)
 }
 
 var (
@@ -31,4 +83,9 @@ var (
 	ErrInvalidOperation        = errors.New("invalid operation for metric type")
 	ErrInvalidLabel            = errors.New("invalid label provided")
 	ErrBackendNotSupported     = errors.New("backend not supported")
+	ErrOperationNotPermitted   = errors.New("operation not permitted by KPI definition")
+	ErrCardinalityExceeded     = errors.New("series cardinality limit exceeded")
+	ErrSeriesNotFound          = errors.New("series not found")
+	ErrJobNotFound             = errors.New("pm job not found")
+	ErrJobExists               = errors.New("pm job already exists")
 )
@@ -1,158 +1,481 @@
 package metrics_wrapper
 
 import (
+	"amantya_metrics/datadogbackend"
+	"amantya_metrics/fanoutbackend"
+	"amantya_metrics/influxbackend"
 	"amantya_metrics/metricsInterface"
 	"amantya_metrics/metricsregistry"
 	"amantya_metrics/models"
+	"amantya_metrics/otlpbackend"
 	"amantya_metrics/prometheusbackend"
+	"amantya_metrics/remotewritebackend"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net/http"
 	"strings"
+	"sync"
 )
 
 type BackendType string
 
 const (
-	PrometheusBackend BackendType = "prometheus"
-	DataDogBackend    BackendType = "datadog"
+	PrometheusBackend  BackendType = "prometheus"
+	DataDogBackend     BackendType = "datadog"
+	OTLPBackend        BackendType = "otlp"
+	RemoteWriteBackend BackendType = "remote_write"
+	InfluxBackend      BackendType = "influx"
 )
 
 type MetricsFramework struct {
-	registry *metricsregistry.Registry
-	backend  metricsInterface.Backend
-	kpIs     []models.KPI
+	registry    *metricsregistry.Registry
+	backend     metricsInterface.Backend
+	kpIs        []models.KPI
+	validation  models.ValidationMode
+	constLabels map[string]string
+	cardinality *cardinalityGuard
+	labelRules  *labelRules
+	janitor     *janitor
+	derived     *derivedSet
+	pmMu        sync.Mutex
+	pmJobs      map[string]*pmJob
 }
 
+// MetricsType creates a framework for backendType. Several comma-separated
+// types (see Backends) fan every update out to each of them; options for one
+// backend only go in a map under its type, e.g. options["datadog"], and
+// override the top-level ones.
 func MetricsType(backendType BackendType, options map[string]interface{}) (*MetricsFramework, error) {
-	var backend metricsInterface.Backend
-	var err error
+	backend, err := newBackend(backendType, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return MetricsWithBackend(backend, options)
+}
+
+// MetricsWithBackend creates a framework around a backend built by the caller,
+// such as the in-memory backend of package metricstest. Options are those of
+// MetricsType except the backend-specific ones.
+func MetricsWithBackend(backend metricsInterface.Backend, options map[string]interface{}) (*MetricsFramework, error) {
+	validation, err := validationOption(options)
+	if err != nil {
+		return nil, err
+	}
+
+	constLabels, err := stringMapOption(options, OptConstLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	cardinality, err := cardinalityOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetricsFramework{
+		registry:    metricsregistry.NewRegistry(),
+		backend:     backend,
+		validation:  validation,
+		constLabels: constLabels,
+		cardinality: cardinality,
+		labelRules:  newLabelRules(),
+		janitor:     &janitor{},
+		derived:     newDerivedSet(),
+		pmJobs:      make(map[string]*pmJob),
+	}, nil
+}
+
+// Backends combines backend types for MetricsType, e.g.
+// Backends(DataDogBackend, PrometheusBackend). The first is the primary that
+// answers reads and scrapes.
+func Backends(types ...BackendType) BackendType {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return BackendType(strings.Join(names, ","))
+}
+
+func newBackend(backendType BackendType, options map[string]interface{}) (metricsInterface.Backend, error) {
+	types := strings.Split(string(backendType), ",")
+	if len(types) == 1 {
+		return newSingleBackend(backendType, options)
+	}
+
+	children := make([]fanoutbackend.Child, 0, len(types))
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		for _, child := range children {
+			if child.Name == t {
+				closeBackends(children)
+				return nil, fmt.Errorf("backend %s listed twice", t)
+			}
+		}
+
+		childOptions, err := backendOptions(options, t)
+		if err != nil {
+			closeBackends(children)
+			return nil, err
+		}
+		backend, err := newSingleBackend(BackendType(t), childOptions)
+		if err != nil {
+			closeBackends(children)
+			return nil, err
+		}
+		children = append(children, fanoutbackend.Child{Name: t, Backend: backend})
+	}
+	return fanoutbackend.NewFanoutBackend(children...)
+}
 
+func newSingleBackend(backendType BackendType, options map[string]interface{}) (metricsInterface.Backend, error) {
 	switch backendType {
 	case PrometheusBackend:
-		backend = prometheusbackend.NewPrometheusBackend() // Initialize properly
-	// case DataDogBackend:
-	//     namespace, ok := options["namespace"].(string)
-	//     if !ok {
-	//         namespace = "amantya"
-	//     }
-	//     backend, err = datadogbackend.NewDataDogBackend(namespace)
+		return prometheusbackend.NewPrometheusBackend(), nil // Initialize properly
+	case DataDogBackend:
+		cfg, err := dataDogConfig(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datadog options: %w", err)
+		}
+		return datadogbackend.NewDataDogBackend(cfg)
+	case OTLPBackend:
+		cfg, err := otlpConfig(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otlp options: %w", err)
+		}
+		return otlpbackend.NewOTLPBackend(cfg)
+	case RemoteWriteBackend:
+		cfg, err := remoteWriteConfig(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote_write options: %w", err)
+		}
+		return remotewritebackend.NewRemoteWriteBackend(cfg)
+	case InfluxBackend:
+		cfg, err := influxConfig(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid influx options: %w", err)
+		}
+		return influxbackend.NewInfluxBackend(cfg)
 	default:
 		return nil, fmt.Errorf("%w: %s", metricsInterface.ErrBackendNotSupported, backendType)
 	}
+}
+
+// closeBackends releases the backends created before a later one failed.
+func closeBackends(children []fanoutbackend.Child) {
+	for _, child := range children {
+		if closer, ok := child.Backend.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
 
+// LoadKPIs replaces the KPI catalogue with the KPIs found at the given
+// sources. Each source may be a JSON/YAML file, a directory or a glob pattern.
+func (mf *MetricsFramework) LoadKPIs(sources ...string) error {
+	kpIs, err := models.LoadKPIs(sources...)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to load KPIs: %w", err)
 	}
 
-	return &MetricsFramework{
-		registry: metricsregistry.NewRegistry(),
-		backend:  backend,
-	}, nil
+	return mf.SetKPIs(kpIs)
+}
+
+// LoadKPIsFromFS loads the catalogue from an fs.FS such as an embed.FS.
+func (mf *MetricsFramework) LoadKPIsFromFS(fsys fs.FS, sources ...string) error {
+	kpIs, err := models.LoadKPIsFromFS(fsys, sources...)
+	if err != nil {
+		return fmt.Errorf("failed to load KPIs: %w", err)
+	}
+
+	return mf.SetKPIs(kpIs)
 }
 
-func (mf *MetricsFramework) LoadKPIs(filePath string) error {
-	kpIs, err := models.LoadKPIsFromFile(filePath)
+// LoadKPIsFromReader loads the catalogue from a single JSON or YAML document.
+func (mf *MetricsFramework) LoadKPIsFromReader(r io.Reader, format models.Format) error {
+	kpIs, err := models.LoadKPIsFromReader(r, format)
 	if err != nil {
 		return fmt.Errorf("failed to load KPIs: %w", err)
 	}
 
+	return mf.SetKPIs(kpIs)
+}
+
+// SetKPIValidation selects whether catalogue problems fail LoadKPIs
+// (models.ValidationStrict, the default) or are only logged.
+func (mf *MetricsFramework) SetKPIValidation(mode models.ValidationMode) {
+	mf.validation = mode
+}
+
+// SetKPIs validates and installs an in-memory catalogue, e.g. one built in a
+// test.
+func (mf *MetricsFramework) SetKPIs(kpIs []models.KPI) error {
+	if err := models.ValidateKPIs(kpIs, mf.validation); err != nil {
+		return fmt.Errorf("invalid KPI catalogue: %w", err)
+	}
+
 	mf.kpIs = kpIs
 	return nil
 }
+
 func (m *MetricsFramework) Backend() interface{} {
 	return m.backend
 }
 
+// Handler exposes the backend for scraping, evaluating derived KPIs that are
+// computed on read first. Backends without a pull mode answer with 501 Not
+// Implemented.
+func (m *MetricsFramework) Handler() http.Handler {
+	if sb, ok := m.backend.(metricsInterface.ScrapeBackend); ok {
+		handler := sb.Handler()
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := m.refreshDerived(""); err != nil {
+				log.Printf("Serving stale derived KPIs: %v", err)
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, metricsInterface.ErrBackendNotSupported.Error(), http.StatusNotImplemented)
+	})
+}
+
 func (m *MetricsFramework) GetKPIs() []models.KPI {
 	return m.kpIs
 }
 
-func normalizeMetricName(displayName string) string {
-	name := strings.ToLower(displayName)
-	name = strings.ReplaceAll(name, " ", "_")
-	name = strings.ReplaceAll(name, "-", "_")
-	name = strings.ReplaceAll(name, "(", "")
-	name = strings.ReplaceAll(name, ")", "")
-	if len(name) > 0 && (name[0] >= '0' && name[0] <= '9') {
-		name = "g" + name
-	}
-	return name
-}
 func (mf *MetricsFramework) RegisterMetrics() error {
+	if err := mf.registerOverflowCounter(); err != nil {
+		return err
+	}
+
 	for _, kpi := range mf.kpIs {
 		// Ensure consistent naming
-		metricName := normalizeMetricName(kpi.DisplayName)
+		metricName := kpi.MetricName()
 
 		// Check if metric already exists
 		if _, err := mf.registry.Get(metricName); err == nil {
 			continue // Skip if already registered
 		}
 
+		// Checked before the metric is created, as a sampling gauge starts
+		// its sampler right away
+		ttl, err := kpi.TTL()
+		if err != nil {
+			return fmt.Errorf("invalid series_ttl for %s: %w", metricName, err)
+		}
+		if err := mf.labelRules.track(metricName, kpi); err != nil {
+			return fmt.Errorf("invalid label_values for %s: %w", metricName, err)
+		}
+
+		backend, err := mf.backendFor(kpi)
+		if err != nil {
+			return fmt.Errorf("failed to create metric %s: %w", metricName, err)
+		}
+
 		var metric metricsInterface.Metric
-		var err error
 
-		switch kpi.PrometheusType {
-		case "Counter":
-			metric, err = mf.backend.NewCounter(metricName, kpi.Description, kpi.Object)
+		switch kpi.MetricType() {
 		case "Gauge":
-			metric, err = mf.backend.NewGauge(metricName, kpi.Description, kpi.Object)
+			ib, instruments := backend.(metricsInterface.InstrumentBackend)
+			if kpi.Sampled() {
+				metric, err = newSamplingGauge(backend, metricName, kpi)
+			} else if instruments && kpi.UpDown() {
+				metric, err = ib.NewUpDownCounter(metricName, kpi.Description, kpi.Object)
+			} else {
+				metric, err = backend.NewGauge(metricName, kpi.Description, kpi.Object)
+			}
+		case "Counter":
+			metric, err = backend.NewCounter(metricName, kpi.Description, kpi.Object)
+		case "Histogram":
+			metric, err = backend.NewHistogram(metricName, kpi.Description, kpi.Object, kpi.Buckets)
+		case "Summary":
+			objectives, perr := kpi.SummaryObjectives()
+			if perr != nil {
+				return fmt.Errorf("invalid objectives for %s: %w", metricName, perr)
+			}
+			maxAge, perr := kpi.SummaryMaxAge()
+			if perr != nil {
+				return fmt.Errorf("invalid max_age for %s: %w", metricName, perr)
+			}
+			metric, err = backend.NewSummary(metricName, kpi.Description, kpi.Object, objectives, maxAge)
 		default:
-			return fmt.Errorf("unsupported metric type: %s", kpi.PrometheusType)
+			return fmt.Errorf("unsupported metric type: %s", kpi.MetricType())
 		}
 
 		if err != nil {
 			return fmt.Errorf("failed to create metric %s: %w", metricName, err)
 		}
 
-		if err := mf.registry.Register(metricName, metric); err != nil {
+		if err := mf.registry.RegisterKPI(metricName, metric, kpi); err != nil {
+			stopSampler(metric)
 			return fmt.Errorf("failed to register metric %s: %w", metricName, err)
 		}
+		mf.cardinality.track(metricName, kpi, ttl)
 		log.Printf("Successfully registered metric: %s", metricName)
 	}
+
+	if err := mf.trackDerived(); err != nil {
+		return err
+	}
+
+	mf.startExpiry()
+	mf.startDerived()
 	return nil
 }
 
+// ConstLabels returns the framework-wide constant labels.
+func (mf *MetricsFramework) ConstLabels() map[string]string {
+	return mf.constLabels
+}
+
+// backendFor returns the backend view that attaches the KPI's constant
+// labels (framework-wide labels plus the KPI's own overrides) and, for
+// backends that support them, the KPI's unit and NF type.
+func (mf *MetricsFramework) backendFor(kpi models.KPI) (metricsInterface.Backend, error) {
+	backend := mf.backend
+	constLabels := kpi.MergeConstLabels(mf.constLabels)
+	if len(constLabels) > 0 {
+		for _, label := range kpi.Object {
+			if _, clash := constLabels[label]; clash {
+				return nil, fmt.Errorf("%w: constant label %s is also a KPI object label", metricsInterface.ErrInvalidLabel, label)
+			}
+		}
+		backend = backend.WithConstLabels(constLabels)
+	}
+
+	if ib, ok := backend.(metricsInterface.InstrumentBackend); ok && kpi.Unit != "" {
+		backend = ib.WithUnit(kpi.Unit)
+	}
+	if tb, ok := backend.(metricsInterface.TaggingBackend); ok && kpi.NFType != "" {
+		backend = tb.WithNFType(kpi.NFType)
+	}
+	return backend, nil
+}
+
 func (mf *MetricsFramework) GetMetric(name string) (metricsInterface.Metric, error) {
 	return mf.registry.Get(name)
 }
 
-func (mf *MetricsFramework) IncrementMetric(name string, labels map[string]string) error {
-	metric, err := mf.registry.Get(name)
+// ResolveMetric maps a metric reference (registered name, KPI name, display
+// name or any spelling that normalizes to one of them) to the registered name.
+func (mf *MetricsFramework) ResolveMetric(name string) (string, error) {
+	return mf.registry.Resolve(name)
+}
+
+// GetMetricKPI returns the KPI definition a registered metric was created from.
+func (mf *MetricsFramework) GetMetricKPI(name string) (models.KPI, error) {
+	kpi, ok := mf.registry.GetKPI(name)
+	if !ok {
+		return models.KPI{}, metricsInterface.ErrMetricNotFound
+	}
+	return kpi, nil
+}
+
+// operation is a metric update that passed the KPI checks.
+type operation struct {
+	name      string
+	metric    metricsInterface.Metric
+	labels    map[string]string
+	admission *admission
+}
+
+// begin resolves name and runs the checks shared by every update: KPI
+// permissions for the direction of delta (0 for Set/Observe; SetMetric checks
+// the new value itself), the KPI label list, the KPI's allowed label values,
+// and the cardinality guard. A nil operation with a nil error means the
+// update was dropped by the overflow policy.
+func (mf *MetricsFramework) begin(op, name string, delta float64, labels map[string]string) (*operation, error) {
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := mf.registry.Get(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if err := mf.checkNotDerived(op, resolved); err != nil {
+		return nil, err
+	}
+	if err := mf.checkPermission(resolved, delta); err != nil {
+		return nil, err
+	}
+	if err := mf.checkLabels(op, resolved, labels); err != nil {
+		return nil, err
+	}
+	labels, err = mf.labelRules.apply(op, resolved, labels)
 	if err != nil {
+		return nil, err
+	}
+
+	admitted, err := mf.cardinality.admit(op, resolved, labels)
+	if err != nil || admitted == nil {
+		return nil, err
+	}
+	return &operation{name: resolved, metric: metric, labels: admitted.labels, admission: admitted}, nil
+}
+
+// finish passes the outcome of the backend write to the cardinality guard and
+// returns it.
+func (mf *MetricsFramework) finish(o *operation, err error) error {
+	mf.cardinality.settle(o.admission, err)
+	return err
+}
+
+func (mf *MetricsFramework) IncrementMetric(name string, labels map[string]string) error {
+	o, err := mf.begin("increment", name, 1, labels)
+	if o == nil {
 		return err
 	}
 
-	return metric.Inc(labels)
+	return mf.finish(o, o.metric.Inc(o.labels))
 }
 
 func (mf *MetricsFramework) DecrementMetric(name string, labels map[string]string) error {
-	metric, err := mf.registry.Get(name)
-	if err != nil {
+	o, err := mf.begin("decrement", name, -1, labels)
+	if o == nil {
 		return err
 	}
 
-	return metric.Dec(labels)
+	return mf.finish(o, o.metric.Dec(o.labels))
 }
 
 func (mf *MetricsFramework) AddToMetric(name string, value float64, labels map[string]string) error {
-	metric, err := mf.registry.Get(name)
-	if err != nil {
+	o, err := mf.begin("add", name, value, labels)
+	if o == nil {
 		return err
 	}
 
-	return metric.Add(value, labels)
+	return mf.finish(o, o.metric.Add(value, o.labels))
 }
 
 func (mf *MetricsFramework) SetMetric(name string, value float64, labels map[string]string) error {
-	metric, err := mf.registry.Get(name)
-	if err != nil {
+	o, err := mf.begin("set", name, 0, labels)
+	if o == nil {
+		return err
+	}
+	if err := mf.checkSetPermission(o.name, o.metric, value, o.labels); err != nil {
+		return mf.finish(o, err)
+	}
+
+	return mf.finish(o, o.metric.Set(value, o.labels))
+}
+
+func (mf *MetricsFramework) ObserveMetric(name string, value float64, labels map[string]string) error {
+	o, err := mf.begin("observe", name, 0, labels)
+	if o == nil {
 		return err
 	}
 
-	return metric.Set(value, labels)
+	return mf.finish(o, o.metric.Observe(value, o.labels))
 }
 
 func (mf *MetricsFramework) PushMetrics(gatewayURL, jobName string) error {
+	if err := mf.refreshDerived(""); err != nil {
+		log.Printf("Pushing stale derived KPIs: %v", err)
+	}
 	return mf.backend.PushToGateway(gatewayURL, jobName)
 }
 
@@ -161,7 +484,22 @@ func (mf *MetricsFramework) ListMetrics() []string {
 }
 
 func (mf *MetricsFramework) UnregisterMetric(name string) error {
-	return mf.registry.Unregister(name)
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return err
+	}
+	metric, err := mf.registry.Get(resolved)
+	if err != nil {
+		return err
+	}
+	if err := mf.registry.Unregister(resolved); err != nil {
+		return err
+	}
+	stopSampler(metric)
+	mf.cardinality.forget(resolved)
+	mf.labelRules.forget(resolved)
+	mf.derived.forget(resolved)
+	return nil
 }
 
 func PushWithDefaults(mf *MetricsFramework, gatewayURL, jobName string) error {
@@ -171,32 +509,37 @@ func PushWithDefaults(mf *MetricsFramework, gatewayURL, jobName string) error {
 	return mf.PushMetrics(gatewayURL, jobName)
 }
 
-func createDefaultLabels(objects []string) map[string]string {
-	labels := make(map[string]string)
-	for _, obj := range objects {
-		labels[obj] = "default_" + obj
-	}
-	return labels
-}
-
-// InitializeDefaults sets zero values for all registered metrics
+// InitializeDefaults sets zero values for all registered metrics, one series
+// per combination of the values declared in label_values. KPIs with an object
+// label that has no enumerated values are skipped.
 func (mf *MetricsFramework) InitializeDefaults() error {
 	for _, kpi := range mf.kpIs {
-		metricName := normalizeMetricName(kpi.DisplayName)
-		labels := createDefaultLabels(kpi.Object)
+		if kpi.Derived() {
+			continue // Set by the framework when evaluated
+		}
+		metricName := kpi.MetricName()
+		labelSets, ok := kpi.DeclaredLabelSets()
+		if !ok {
+			log.Printf("Skipping initialization for %s: not every label has declared values", metricName)
+			continue
+		}
 
-		switch kpi.PrometheusType {
-		case "Counter":
-			if err := mf.AddToMetric(metricName, 0, labels); err != nil {
-				return fmt.Errorf("failed to initialize counter %s: %w", metricName, err)
+		for _, labels := range labelSets {
+			switch kpi.MetricType() {
+			case "Counter":
+				if err := mf.AddToMetric(metricName, 0, labels); err != nil {
+					return fmt.Errorf("failed to initialize counter %s: %w", metricName, err)
+				}
+			case "Gauge":
+				if err := mf.SetMetric(metricName, 0, labels); err != nil {
+					return fmt.Errorf("failed to initialize gauge %s: %w", metricName, err)
+				}
+			case "Histogram", "Summary":
+				// Observing a zero would skew the distribution, so these start empty
+			default:
+				log.Printf("Skipping initialization for unknown metric type %s (%s)",
+					kpi.MetricType(), metricName)
 			}
-		case "Gauge":
-			if err := mf.SetMetric(metricName, 0, labels); err != nil {
-				return fmt.Errorf("failed to initialize gauge %s: %w", metricName, err)
-			}
-		default:
-			log.Printf("Skipping initialization for unknown metric type %s (%s)",
-				kpi.PrometheusType, metricName)
 		}
 	}
 	return nil
@@ -0,0 +1,391 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/models"
+	"amantya_metrics/utils"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// OverflowValue replaces every label value of an update folded into the
+	// overflow series.
+	OverflowValue = "__overflow__"
+	// OverflowMetricName counts updates dropped or folded by the guard, by
+	// metric and policy.
+	OverflowMetricName = "amantya_metrics_series_overflow_total"
+)
+
+// CardinalityStats describes the label sets seen for one metric.
+type CardinalityStats struct {
+	Metric   string                `json:"metric"`
+	Series   int                   `json:"series"`
+	Limit    int                   `json:"limit"`
+	Policy   models.OverflowPolicy `json:"policy"`
+	Rejected uint64                `json:"rejected"`
+	Dropped  uint64                `json:"dropped"`
+	Folded   uint64                `json:"folded"`
+}
+
+// seriesEntry is one label set of a metric. A new series holds its slot
+// while backend writes are in flight and keeps it once one succeeds, so a
+// rejected write does not use up the limit.
+type seriesEntry struct {
+	labels    map[string]string
+	lastSeen  time.Time
+	committed bool
+	inFlight  int
+}
+
+// admission is an update let through by the guard. pending is set when the
+// series is not yet committed and the outcome must be passed to settle.
+type admission struct {
+	name    string
+	key     string
+	labels  map[string]string
+	pending bool
+}
+
+type seriesSet struct {
+	keys                      map[string]*seriesEntry
+	limit                     int
+	policy                    models.OverflowPolicy
+	ttl                       time.Duration
+	rejected, dropped, folded uint64
+}
+
+// cardinalityGuard tracks the distinct label sets written to each metric and
+// applies the overflow policy once a per-metric or global limit is reached.
+// It also remembers when each series was last written, for series_ttl.
+type cardinalityGuard struct {
+	mu            sync.Mutex
+	metrics       map[string]*seriesSet
+	total         int
+	globalLimit   int
+	defaultLimit  int
+	defaultPolicy models.OverflowPolicy
+	overflow      metricsInterface.Metric
+}
+
+func newCardinalityGuard(globalLimit, defaultLimit int, defaultPolicy models.OverflowPolicy) *cardinalityGuard {
+	if defaultPolicy == "" {
+		defaultPolicy = models.OverflowReject
+	}
+	return &cardinalityGuard{
+		metrics:       make(map[string]*seriesSet),
+		globalLimit:   globalLimit,
+		defaultLimit:  defaultLimit,
+		defaultPolicy: defaultPolicy,
+	}
+}
+
+func (g *cardinalityGuard) track(name string, kpi models.KPI, ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	limit, policy := kpi.MaxSeries, kpi.OverflowPolicy
+	if limit == 0 {
+		limit = g.defaultLimit
+	}
+	if policy == "" {
+		policy = g.defaultPolicy
+	}
+	g.metrics[name] = &seriesSet{
+		keys:   make(map[string]*seriesEntry),
+		limit:  limit,
+		policy: policy,
+		ttl:    ttl,
+	}
+}
+
+func (g *cardinalityGuard) forget(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if set, ok := g.metrics[name]; ok {
+		g.total -= len(set.keys)
+		delete(g.metrics, name)
+	}
+}
+
+// admit decides what happens to an update of name with labels. It returns
+// the labels to write (rewritten to the overflow series when folding), or a
+// nil admission and a nil error when the update is dropped.
+func (g *cardinalityGuard) admit(op, name string, labels map[string]string) (*admission, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	g.mu.Lock()
+	a, overflowed, err := g.admitLocked(op, name, labels)
+	overflow := g.overflow
+	g.mu.Unlock()
+
+	// The overflow counter is a backend write and may block on I/O
+	if overflowed != "" && overflow != nil {
+		if err := overflow.Inc(map[string]string{"metric": name, "policy": string(overflowed)}); err != nil {
+			log.Printf("Failed to count overflow for %s: %v", name, err)
+		}
+	}
+	return a, err
+}
+
+// admitLocked is admit with g.mu held. overflowed is the policy applied when
+// the update is dropped or folded.
+func (g *cardinalityGuard) admitLocked(op, name string, labels map[string]string) (*admission, models.OverflowPolicy, error) {
+	set, ok := g.metrics[name]
+	if !ok {
+		return &admission{name: name, labels: labels}, "", nil
+	}
+
+	now := time.Now()
+	key := metricsInterface.SeriesKey(labels)
+	if _, seen := set.keys[key]; seen {
+		return g.use(set, name, key, labels, now), "", nil
+	}
+
+	overMetric := set.limit > 0 && len(set.keys) >= set.limit
+	overGlobal := g.globalLimit > 0 && g.total >= g.globalLimit
+	if !overMetric && !overGlobal {
+		return g.use(set, name, key, labels, now), "", nil
+	}
+
+	switch set.policy {
+	case models.OverflowDrop:
+		set.dropped++
+		return nil, set.policy, nil
+	case models.OverflowFold:
+		set.folded++
+		folded := make(map[string]string, len(labels))
+		for k := range labels {
+			folded[k] = OverflowValue
+		}
+		// The overflow series is always allowed so folding never fails
+		foldedKey := metricsInterface.SeriesKey(folded)
+		return g.use(set, name, foldedKey, folded, now), set.policy, nil
+	default:
+		set.rejected++
+		limit := fmt.Sprintf("%d series per metric", set.limit)
+		if !overMetric {
+			limit = fmt.Sprintf("%d series in total", g.globalLimit)
+		}
+		return nil, "", utils.NewMetricError(op, name,
+			fmt.Errorf("%w: limit of %s reached", metricsInterface.ErrCardinalityExceeded, limit))
+	}
+}
+
+// use admits a write to the series at key, taking a slot for it if it is
+// new. Writes to a series that is not committed yet are pending.
+func (g *cardinalityGuard) use(set *seriesSet, name, key string, labels map[string]string, now time.Time) *admission {
+	entry, seen := set.keys[key]
+	if !seen {
+		entry = g.add(set, key, labels, now)
+	}
+	entry.lastSeen = now
+	if entry.committed {
+		return &admission{name: name, key: key, labels: labels}
+	}
+	entry.inFlight++
+	return &admission{name: name, key: key, labels: labels, pending: true}
+}
+
+// settle records the outcome of the backend write of a pending admission:
+// success commits the series, and when every write to a series that was never
+// committed has failed its slot is given back.
+func (g *cardinalityGuard) settle(a *admission, err error) {
+	if a == nil || !a.pending {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	set, ok := g.metrics[a.name]
+	if !ok {
+		return
+	}
+	entry, ok := set.keys[a.key]
+	if !ok {
+		return
+	}
+	entry.inFlight--
+	switch {
+	case err == nil:
+		entry.committed = true
+	case !entry.committed && entry.inFlight <= 0:
+		delete(set.keys, a.key)
+		g.total--
+	}
+}
+
+func (g *cardinalityGuard) add(set *seriesSet, key string, labels map[string]string, now time.Time) *seriesEntry {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	entry := &seriesEntry{labels: copied, lastSeen: now}
+	set.keys[key] = entry
+	g.total++
+	return entry
+}
+
+// remove forgets the series of name with exactly these labels.
+func (g *cardinalityGuard) remove(name string, labels map[string]string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	set, ok := g.metrics[name]
+	if !ok {
+		return false
+	}
+	key := metricsInterface.SeriesKey(labels)
+	if _, ok := set.keys[key]; !ok {
+		return false
+	}
+	delete(set.keys, key)
+	g.total--
+	return true
+}
+
+// removeMatching forgets every series of name whose labels include subset.
+func (g *cardinalityGuard) removeMatching(name string, subset map[string]string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	set, ok := g.metrics[name]
+	if !ok {
+		return 0
+	}
+	removed := 0
+	for key, entry := range set.keys {
+		if metricsInterface.MatchesLabels(entry.labels, subset) {
+			delete(set.keys, key)
+			removed++
+		}
+	}
+	g.total -= removed
+	return removed
+}
+
+// expire forgets the series not written within their metric's TTL, calls
+// deleteSeries for each with the guard lock held and returns how many there
+// were. Holding the lock keeps a concurrent write from being admitted between
+// the two, which would leave it without its backend series. Series with
+// writes in flight are kept.
+func (g *cardinalityGuard) expire(now time.Time, deleteSeries func(name string, labels map[string]string)) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	expired := 0
+	for name, set := range g.metrics {
+		if set.ttl <= 0 {
+			continue
+		}
+		for key, entry := range set.keys {
+			if entry.inFlight == 0 && now.Sub(entry.lastSeen) > set.ttl {
+				deleteSeries(name, entry.labels)
+				delete(set.keys, key)
+				g.total--
+				expired++
+			}
+		}
+	}
+	return expired
+}
+
+// minTTL returns the shortest series_ttl among tracked metrics, or zero.
+func (g *cardinalityGuard) minTTL() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var shortest time.Duration
+	for _, set := range g.metrics {
+		if set.ttl > 0 && (shortest == 0 || set.ttl < shortest) {
+			shortest = set.ttl
+		}
+	}
+	return shortest
+}
+
+func (g *cardinalityGuard) stats(name string) (CardinalityStats, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	set, ok := g.metrics[name]
+	if !ok {
+		return CardinalityStats{}, false
+	}
+	return CardinalityStats{
+		Metric:   name,
+		Series:   len(set.keys),
+		Limit:    set.limit,
+		Policy:   set.policy,
+		Rejected: set.rejected,
+		Dropped:  set.dropped,
+		Folded:   set.folded,
+	}, true
+}
+
+func (g *cardinalityGuard) report() []CardinalityStats {
+	g.mu.Lock()
+	names := make([]string, 0, len(g.metrics))
+	for name := range g.metrics {
+		names = append(names, name)
+	}
+	g.mu.Unlock()
+
+	sort.Strings(names)
+	report := make([]CardinalityStats, 0, len(names))
+	for _, name := range names {
+		if stats, ok := g.stats(name); ok {
+			report = append(report, stats)
+		}
+	}
+	return report
+}
+
+// registerOverflowCounter creates the backend counter behind
+// OverflowMetricName the first time metrics are registered.
+func (mf *MetricsFramework) registerOverflowCounter() error {
+	if mf.cardinality.overflow != nil {
+		return nil
+	}
+
+	backend, err := mf.backendFor(models.KPI{})
+	if err != nil {
+		return err
+	}
+	counter, err := backend.NewCounter(OverflowMetricName,
+		"Updates dropped or folded because a metric reached its series limit.",
+		[]string{"metric", "policy"})
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", OverflowMetricName, err)
+	}
+
+	mf.cardinality.mu.Lock()
+	mf.cardinality.overflow = counter
+	mf.cardinality.mu.Unlock()
+	return nil
+}
+
+// Cardinality returns the series count, limit and overflow counters of a metric.
+func (mf *MetricsFramework) Cardinality(name string) (CardinalityStats, error) {
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return CardinalityStats{}, err
+	}
+	stats, ok := mf.cardinality.stats(resolved)
+	if !ok {
+		return CardinalityStats{}, metricsInterface.ErrMetricNotFound
+	}
+	return stats, nil
+}
+
+// CardinalityReport returns Cardinality for every registered metric, sorted by name.
+func (mf *MetricsFramework) CardinalityReport() []CardinalityStats {
+	return mf.cardinality.report()
+}
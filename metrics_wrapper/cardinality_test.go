@@ -0,0 +1,135 @@
+package metrics_wrapper_test
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/metricstest"
+	"amantya_metrics/models"
+	"errors"
+	"testing"
+)
+
+func limitedCounter(policy models.OverflowPolicy) models.KPI {
+	return models.KPI{
+		Name:           "SessionRequests",
+		DisplayName:    "Session Requests",
+		PrometheusType: "Counter",
+		Object:         []string{"Cause"},
+		Increment:      true,
+		MaxSeries:      2,
+		OverflowPolicy: policy,
+	}
+}
+
+func cause(value string) map[string]string {
+	return map[string]string{"Cause": value}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy     models.OverflowPolicy
+		wantErr    error
+		wantSeries int
+		stats      metrics_wrapper.CardinalityStats
+	}{
+		{policy: models.OverflowReject, wantErr: metricsInterface.ErrCardinalityExceeded, wantSeries: 2,
+			stats: metrics_wrapper.CardinalityStats{Series: 2, Rejected: 2}},
+		{policy: models.OverflowDrop, wantSeries: 2,
+			stats: metrics_wrapper.CardinalityStats{Series: 2, Dropped: 2}},
+		// The overflow series is admitted beyond the limit
+		{policy: models.OverflowFold, wantSeries: 3,
+			stats: metrics_wrapper.CardinalityStats{Series: 3, Folded: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			fw, backend := metricstest.NewFramework(t, limitedCounter(tt.policy))
+
+			for _, c := range []string{"a", "b"} {
+				if err := fw.IncrementMetric("SessionRequests", cause(c)); err != nil {
+					t.Fatalf("increment below the limit: %v", err)
+				}
+			}
+			for _, c := range []string{"c", "d"} {
+				err := fw.IncrementMetric("SessionRequests", cause(c))
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("increment over the limit: got %v, want %v", err, tt.wantErr)
+				}
+			}
+			// Series already admitted keep being written
+			if err := fw.IncrementMetric("SessionRequests", cause("a")); err != nil {
+				t.Errorf("increment of an admitted series: %v", err)
+			}
+
+			series, err := fw.GetMetricSeries("SessionRequests")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(series) != tt.wantSeries {
+				t.Errorf("got %d series, want %d", len(series), tt.wantSeries)
+			}
+			metricstest.AssertCounter(t, fw, "SessionRequests", cause("a"), 2)
+
+			stats, err := fw.Cardinality("SessionRequests")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.stats
+			want.Metric, want.Limit, want.Policy = "session_requests", 2, tt.policy
+			if stats != want {
+				t.Errorf("Cardinality() = %+v, want %+v", stats, want)
+			}
+
+			overflow := backend.CallsFor(metrics_wrapper.OverflowMetricName)
+			if wantCalls := int(stats.Dropped + stats.Folded); len(overflow) != wantCalls {
+				t.Errorf("overflow counter incremented %d times, want %d", len(overflow), wantCalls)
+			}
+		})
+	}
+}
+
+func TestFoldedSeries(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, limitedCounter(models.OverflowFold))
+
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		if err := fw.IncrementMetric("SessionRequests", cause(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metricstest.AssertCounter(t, fw, "SessionRequests", cause(metrics_wrapper.OverflowValue), 3)
+	metricstest.AssertNoSeries(t, fw, "SessionRequests", cause("c"))
+}
+
+func TestRejectedWriteFreesSlot(t *testing.T) {
+	kpi := limitedCounter(models.OverflowReject)
+	kpi.MaxSeries = 1
+	fw, _ := metricstest.NewFramework(t, kpi)
+
+	// A counter cannot be set; the backend rejects the write
+	if err := fw.SetMetric("SessionRequests", 5, cause("a")); !errors.Is(err, metricsInterface.ErrInvalidOperation) {
+		t.Fatalf("SetMetric on a counter: got %v, want ErrInvalidOperation", err)
+	}
+	if stats, _ := fw.Cardinality("SessionRequests"); stats.Series != 0 {
+		t.Errorf("rejected write kept a slot: %+v", stats)
+	}
+	if err := fw.IncrementMetric("SessionRequests", cause("b")); err != nil {
+		t.Errorf("increment after a rejected write: %v", err)
+	}
+}
+
+func TestDeleteFreesSlot(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, limitedCounter(models.OverflowReject))
+
+	for _, c := range []string{"a", "b"} {
+		if err := fw.IncrementMetric("SessionRequests", cause(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := fw.DeletePartialMatch("SessionRequests", cause("a"))
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeletePartialMatch() = %d, %v, want 1", deleted, err)
+	}
+	if err := fw.IncrementMetric("SessionRequests", cause("c")); err != nil {
+		t.Errorf("increment after deleting a series: %v", err)
+	}
+}
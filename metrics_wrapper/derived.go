@@ -0,0 +1,464 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/models"
+	"amantya_metrics/utils"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// derivedMetric is a gauge computed from the expression of its KPI.
+type derivedMetric struct {
+	name     string
+	labels   []string
+	expr     models.Expr
+	refs     map[string]string // metric as written in the expression -> registered name
+	interval time.Duration
+	usesRate bool
+	deps     []string // derived metrics referenced by the expression
+	order    int      // position in dependency order
+
+	mu    sync.Mutex
+	rates map[string]rateSample
+}
+
+type rateSample struct {
+	value float64
+	at    time.Time
+}
+
+// derivedSet holds the derived metrics and the loops evaluating them, one per
+// distinct eval_interval.
+type derivedSet struct {
+	mu      sync.RWMutex
+	metrics map[string]*derivedMetric
+	loops   map[time.Duration]*janitor
+}
+
+func newDerivedSet() *derivedSet {
+	return &derivedSet{
+		metrics: make(map[string]*derivedMetric),
+		loops:   make(map[time.Duration]*janitor),
+	}
+}
+
+func (d *derivedSet) get(name string) (*derivedMetric, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	dm, ok := d.metrics[name]
+	return dm, ok
+}
+
+func (d *derivedSet) forget(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.metrics, name)
+}
+
+// list returns the derived metrics evaluated at interval in dependency order,
+// so each is computed after the derived metrics it references.
+func (d *derivedSet) list(interval time.Duration) []*derivedMetric {
+	return d.filter(func(dm *derivedMetric) bool { return dm.interval == interval })
+}
+
+func (d *derivedSet) filter(keep func(*derivedMetric) bool) []*derivedMetric {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var metrics []*derivedMetric
+	for _, dm := range d.metrics {
+		if keep(dm) {
+			metrics = append(metrics, dm)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].order < metrics[j].order })
+	return metrics
+}
+
+// closure returns name and the derived metrics it depends on that are
+// evaluated on read, in dependency order. Dependencies with an eval_interval
+// keep the value of their last evaluation.
+func (d *derivedSet) closure(name string) []*derivedMetric {
+	d.mu.RLock()
+	needed := make(map[string]bool)
+	var visit func(string)
+	visit = func(name string) {
+		dm, ok := d.metrics[name]
+		if !ok || dm.interval != 0 || needed[name] {
+			return
+		}
+		needed[name] = true
+		for _, dep := range dm.deps {
+			visit(dep)
+		}
+	}
+	visit(name)
+	d.mu.RUnlock()
+
+	return d.filter(func(dm *derivedMetric) bool { return needed[dm.name] })
+}
+
+// sortDerived orders the derived metrics so that every one comes after the
+// derived metrics its expression references, and rejects cycles.
+func (d *derivedSet) sortDerived() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	names := make([]string, 0, len(d.metrics))
+	for name := range d.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(names))
+	order := 0
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("derived KPIs reference each other: %s -> %s", strings.Join(path, " -> "), name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		dm := d.metrics[name]
+		for _, dep := range dm.deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		dm.order = order
+		order++
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *derivedSet) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for interval, loop := range d.loops {
+		loop.stop()
+		delete(d.loops, interval)
+	}
+}
+
+// trackDerived prepares the derived KPIs once every metric is registered, so
+// expressions can reference KPIs defined later in the catalogue.
+func (mf *MetricsFramework) trackDerived() error {
+	for _, kpi := range mf.kpIs {
+		if !kpi.Derived() {
+			continue
+		}
+		name := kpi.MetricName()
+
+		expr, err := models.ParseExpression(kpi.Expression)
+		if err != nil {
+			return fmt.Errorf("invalid expression for %s: %w", name, err)
+		}
+		interval, err := kpi.EvaluationInterval()
+		if err != nil {
+			return fmt.Errorf("invalid eval_interval for %s: %w", name, err)
+		}
+
+		usesRate := models.UsesRate(expr)
+		if usesRate && interval == 0 {
+			return fmt.Errorf("expression for %s uses rate() and needs an eval_interval", name)
+		}
+
+		refs := make(map[string]string)
+		for _, ref := range models.References(expr) {
+			resolved, err := mf.registry.Resolve(ref.Metric)
+			if err != nil {
+				return fmt.Errorf("expression for %s references %s: %w", name, ref.Metric, err)
+			}
+			refs[ref.Metric] = resolved
+		}
+
+		mf.derived.mu.Lock()
+		mf.derived.metrics[name] = &derivedMetric{
+			name:     name,
+			labels:   kpi.Object,
+			expr:     expr,
+			refs:     refs,
+			interval: interval,
+			usesRate: usesRate,
+			rates:    make(map[string]rateSample),
+		}
+		mf.derived.mu.Unlock()
+	}
+
+	mf.derived.mu.Lock()
+	for _, dm := range mf.derived.metrics {
+		dm.deps = dm.deps[:0]
+		for _, resolved := range dm.refs {
+			if _, ok := mf.derived.metrics[resolved]; ok && !slices.Contains(dm.deps, resolved) {
+				dm.deps = append(dm.deps, resolved)
+			}
+		}
+		sort.Strings(dm.deps)
+	}
+	mf.derived.mu.Unlock()
+	return mf.derived.sortDerived()
+}
+
+// startDerived (re)starts one evaluation loop per eval_interval in use.
+func (mf *MetricsFramework) startDerived() {
+	mf.derived.stop()
+
+	mf.derived.mu.Lock()
+	defer mf.derived.mu.Unlock()
+	for _, dm := range mf.derived.metrics {
+		interval := dm.interval
+		if interval == 0 || mf.derived.loops[interval] != nil {
+			continue
+		}
+		loop := &janitor{}
+		mf.derived.loops[interval] = loop
+		loop.start(interval, func() {
+			for _, dm := range mf.derived.list(interval) {
+				if err := mf.evaluate(dm); err != nil {
+					log.Printf("Failed to evaluate %s: %v", dm.name, err)
+				}
+			}
+		})
+	}
+}
+
+// EvaluateDerived evaluates the derived KPIs now, in dependency order,
+// whatever their eval_interval. KPIs using rate() are left to their loop so
+// the rate stays measured over eval_interval.
+func (mf *MetricsFramework) EvaluateDerived() error {
+	var errs []error
+	for _, dm := range mf.derived.filter(func(dm *derivedMetric) bool { return !dm.usesRate }) {
+		if err := mf.evaluate(dm); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dm.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshDerived evaluates the derived KPIs without an eval_interval, which
+// are computed whenever they are read, after the derived KPIs they reference.
+// An empty name refreshes all of them.
+func (mf *MetricsFramework) refreshDerived(name string) error {
+	metrics := mf.derived.list(0)
+	if name != "" {
+		metrics = mf.derived.closure(name)
+	}
+
+	for _, dm := range metrics {
+		if err := mf.evaluate(dm); err != nil {
+			return fmt.Errorf("failed to evaluate %s: %w", dm.name, err)
+		}
+	}
+	return nil
+}
+
+func (mf *MetricsFramework) evaluate(dm *derivedMetric) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	series := make(map[string][]metricsInterface.Sample, len(dm.refs))
+	for ref, name := range dm.refs {
+		metric, err := mf.registry.Get(name)
+		if err != nil {
+			return err
+		}
+		samples, err := metric.Series()
+		if err != nil {
+			return err
+		}
+		series[ref] = samples
+	}
+
+	now := time.Now()
+	for _, target := range dm.targets(series) {
+		value := dm.eval(dm.expr, target, series, now)
+		// Division by zero or an aggregation over no series leaves the last value
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		if err := mf.setDerived(dm.name, value, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targets lists the label sets to compute: every combination of the derived
+// KPI's labels found on the referenced series.
+func (dm *derivedMetric) targets(series map[string][]metricsInterface.Sample) []map[string]string {
+	if len(dm.labels) == 0 {
+		return []map[string]string{{}}
+	}
+
+	seen := make(map[string]map[string]string)
+	for _, samples := range series {
+		for _, sample := range samples {
+			target := make(map[string]string, len(dm.labels))
+			for _, label := range dm.labels {
+				value, ok := sample.Labels[label]
+				if !ok {
+					break
+				}
+				target[label] = value
+			}
+			if len(target) == len(dm.labels) {
+				seen[metricsInterface.SeriesKey(target)] = target
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	targets := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		targets = append(targets, seen[key])
+	}
+	return targets
+}
+
+func (dm *derivedMetric) eval(expr models.Expr, target map[string]string, series map[string][]metricsInterface.Sample, now time.Time) float64 {
+	switch e := expr.(type) {
+	case models.NumberExpr:
+		return e.Value
+	case models.BinaryExpr:
+		left := dm.eval(e.Left, target, series, now)
+		right := dm.eval(e.Right, target, series, now)
+		switch e.Op {
+		case '+':
+			return left + right
+		case '-':
+			return left - right
+		case '*':
+			return left * right
+		case '/':
+			if right == 0 {
+				return math.NaN()
+			}
+			return left / right
+		}
+	case models.RefExpr:
+		return dm.aggregate(e, target, series[e.Metric], now)
+	}
+	return math.NaN()
+}
+
+// aggregate applies the reference's function to the series that match both
+// its selector and the target labels they carry.
+func (dm *derivedMetric) aggregate(ref models.RefExpr, target map[string]string, samples []metricsInterface.Sample, now time.Time) float64 {
+	var values []float64
+	for _, sample := range samples {
+		if !metricsInterface.MatchesLabels(sample.Labels, ref.Matchers) {
+			continue
+		}
+		matches := true
+		for label, value := range target {
+			if got, ok := sample.Labels[label]; ok && got != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			values = append(values, sampleValue(sample))
+		}
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	switch ref.Func {
+	case "count":
+		return float64(len(values))
+	case "avg":
+		if len(values) == 0 {
+			return math.NaN()
+		}
+		return sum / float64(len(values))
+	case "min", "max":
+		if len(values) == 0 {
+			return math.NaN()
+		}
+		result := values[0]
+		for _, v := range values[1:] {
+			if (ref.Func == "min" && v < result) || (ref.Func == "max" && v > result) {
+				result = v
+			}
+		}
+		return result
+	case "rate":
+		key := ref.String() + "\xfe" + metricsInterface.SeriesKey(target)
+		prev, ok := dm.rates[key]
+		dm.rates[key] = rateSample{value: sum, at: now}
+		elapsed := now.Sub(prev.at).Seconds()
+		if !ok || elapsed <= 0 {
+			return math.NaN()
+		}
+		delta := sum - prev.value
+		if delta < 0 {
+			// Counter reset
+			delta = sum
+		}
+		return delta / elapsed
+	default:
+		return sum
+	}
+}
+
+// sampleValue is the value a reference reads: the sum of the observations for
+// histograms and summaries.
+func sampleValue(sample metricsInterface.Sample) float64 {
+	if sample.Count > 0 {
+		return sample.Sum
+	}
+	return sample.Value
+}
+
+// setDerived writes a computed value, bypassing the check in begin that keeps
+// callers from writing derived gauges.
+func (mf *MetricsFramework) setDerived(name string, value float64, labels map[string]string) error {
+	metric, err := mf.registry.Get(name)
+	if err != nil {
+		return err
+	}
+	admitted, err := mf.cardinality.admit("set", name, labels)
+	if err != nil || admitted == nil {
+		return err
+	}
+	err = metric.Set(value, admitted.labels)
+	mf.cardinality.settle(admitted, err)
+	return err
+}
+
+// checkNotDerived rejects writes to derived gauges, which only the framework sets.
+func (mf *MetricsFramework) checkNotDerived(op, name string) error {
+	if _, ok := mf.derived.get(name); ok {
+		return utils.NewMetricError(op, name,
+			fmt.Errorf("%w: %s is derived from an expression", metricsInterface.ErrOperationNotPermitted, name))
+	}
+	return nil
+}
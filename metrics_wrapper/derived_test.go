@@ -0,0 +1,98 @@
+package metrics_wrapper_test
+
+import (
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/metricstest"
+	"amantya_metrics/models"
+	"strings"
+	"testing"
+)
+
+var attempts = models.KPI{
+	Name:           "RegAttempts",
+	DisplayName:    "attempts",
+	PrometheusType: "Counter",
+	Object:         []string{"Result"},
+	Increment:      true,
+}
+
+func derivedKPI(name, expression string) models.KPI {
+	return models.KPI{Name: name, DisplayName: name, PrometheusType: "Gauge", Expression: expression}
+}
+
+func TestDerivedDivisionByZero(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, attempts,
+		derivedKPI("success_rate", `100 * sum(attempts{Result="Success"}) / sum(attempts)`))
+
+	// No attempts yet: the division by zero writes nothing
+	metricstest.AssertNoSeries(t, fw, "success_rate", nil)
+
+	success := map[string]string{"Result": "Success"}
+	failure := map[string]string{"Result": "Failure"}
+	for _, labels := range []map[string]string{success, success, success, failure} {
+		if err := fw.IncrementMetric("attempts", labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metricstest.AssertGauge(t, fw, "success_rate", nil, 75)
+
+	// Once the denominator is zero again the last value stays
+	for _, labels := range []map[string]string{success, failure} {
+		if err := fw.DeleteSeries("attempts", labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metricstest.AssertGauge(t, fw, "success_rate", nil, 75)
+}
+
+func TestDerivedDependencyOrder(t *testing.T) {
+	// failure_rate sorts before success_rate but reads it, so success_rate
+	// has to be evaluated first
+	fw, _ := metricstest.NewFramework(t, attempts,
+		derivedKPI("failure_rate", "100 - success_rate"),
+		derivedKPI("success_rate", `100 * sum(attempts{Result="Success"}) / sum(attempts)`))
+
+	if err := fw.IncrementMetric("attempts", map[string]string{"Result": "Success"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.IncrementMetric("attempts", map[string]string{"Result": "Failure"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading failure_rate alone refreshes success_rate first
+	metricstest.AssertGauge(t, fw, "failure_rate", nil, 50)
+	metricstest.AssertGauge(t, fw, "success_rate", nil, 50)
+}
+
+func TestDerivedCycle(t *testing.T) {
+	fw, err := metrics_wrapper.MetricsWithBackend(metricstest.NewBackend(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+
+	if err := fw.SetKPIs([]models.KPI{derivedKPI("a", "b + 1"), derivedKPI("b", "a + 1")}); err != nil {
+		t.Fatal(err)
+	}
+	err = fw.RegisterMetrics()
+	if err == nil || !strings.Contains(err.Error(), "derived KPIs reference each other: a -> b -> a") {
+		t.Errorf("RegisterMetrics() = %v, want a cycle error", err)
+	}
+}
+
+func TestDerivedRateNeedsInterval(t *testing.T) {
+	fw, err := metrics_wrapper.MetricsWithBackend(metricstest.NewBackend(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+
+	fw.SetKPIValidation(models.ValidationLenient)
+	if err := fw.SetKPIs([]models.KPI{attempts, derivedKPI("attempt_rate", "rate(attempts)")}); err != nil {
+		t.Fatal(err)
+	}
+	err = fw.RegisterMetrics()
+	if err == nil || !strings.Contains(err.Error(), "uses rate() and needs an eval_interval") {
+		t.Errorf("RegisterMetrics() = %v, want an eval_interval error", err)
+	}
+}
@@ -0,0 +1,21 @@
+package metrics_wrapper
+
+import "time"
+
+// SampleAt takes one sample of the sampling gauge name as if at now.
+func SampleAt(mf *MetricsFramework, name string, now time.Time) {
+	metric, _ := mf.GetMetric(name)
+	metric.(*samplingGauge).sample(now)
+}
+
+// SamplerRunning reports whether the sampler of the sampling gauge name is
+// still running.
+func SamplerRunning(mf *MetricsFramework, name string) bool {
+	metric, _ := mf.GetMetric(name)
+	sampler := metric.(*samplingGauge).sampler
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+	return sampler.done != nil
+}
+
+var BackendOptions = backendOptions
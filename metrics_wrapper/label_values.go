@@ -0,0 +1,70 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/models"
+	"amantya_metrics/utils"
+	"fmt"
+	"sync"
+)
+
+// labelRules holds the compiled label_values constraints of each registered
+// metric.
+type labelRules struct {
+	mu      sync.RWMutex
+	metrics map[string]map[string]*models.LabelRule
+}
+
+func newLabelRules() *labelRules {
+	return &labelRules{metrics: make(map[string]map[string]*models.LabelRule)}
+}
+
+func (r *labelRules) track(name string, kpi models.KPI) error {
+	rules, err := kpi.CompileLabelRules()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(rules) == 0 {
+		delete(r.metrics, name)
+		return nil
+	}
+	r.metrics[name] = rules
+	return nil
+}
+
+func (r *labelRules) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.metrics, name)
+}
+
+// apply returns labels with every constrained value checked and, where the
+// KPI allows it, normalized. The caller's map is never modified.
+func (r *labelRules) apply(op, name string, labels map[string]string) (map[string]string, error) {
+	r.mu.RLock()
+	rules := r.metrics[name]
+	r.mu.RUnlock()
+	if len(rules) == 0 {
+		return labels, nil
+	}
+
+	applied := make(map[string]string, len(labels))
+	for label, value := range labels {
+		rule, ok := rules[label]
+		if !ok {
+			applied[label] = value
+			continue
+		}
+
+		recorded, ok := rule.Apply(value)
+		if !ok {
+			return nil, utils.NewMetricError(op, name,
+				fmt.Errorf("%w: value %q not allowed for label %s", metricsInterface.ErrInvalidLabel, value, label))
+		}
+		applied[label] = recorded
+	}
+	return applied, nil
+}
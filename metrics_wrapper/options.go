@@ -0,0 +1,391 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/datadogbackend"
+	"amantya_metrics/influxbackend"
+	"amantya_metrics/models"
+	"amantya_metrics/otlpbackend"
+	"amantya_metrics/remotewritebackend"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option keys understood by MetricsType. Options arriving from the C library
+// are always strings, so list values also accept a comma-separated string.
+const (
+	OptNamespace = "namespace"
+	OptAddress   = "address"
+	OptTags      = "tags"
+	OptTransport = "transport"
+
+	OptInsecure       = "insecure"
+	OptHeaders        = "headers"
+	OptExportInterval = "export_interval"
+	OptExportTimeout  = "export_timeout"
+
+	OptUsername    = "username"
+	OptPassword    = "password"
+	OptBearerToken = "bearer_token"
+	OptBatchSize   = "batch_size"
+	OptQueueSize   = "queue_size"
+	OptMaxRetries  = "max_retries"
+	OptToken       = "token"
+
+	OptKPIValidation = "kpi_validation"
+	OptConstLabels   = "const_labels"
+
+	OptMaxSeries          = "max_series"
+	OptMaxSeriesPerMetric = "max_series_per_metric"
+	OptOverflowPolicy     = "overflow_policy"
+)
+
+func stringOption(options map[string]interface{}, key string) (string, error) {
+	raw, ok := options[key]
+	if !ok || raw == nil {
+		return "", nil
+	}
+	value, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("option %q must be a string, got %T", key, raw)
+	}
+	return value, nil
+}
+
+func stringSliceOption(options map[string]interface{}, key string) ([]string, error) {
+	raw, ok := options[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	var values []string
+	switch v := raw.(type) {
+	case []string:
+		values = v
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("option %q must contain strings, got %T", key, item)
+			}
+			values = append(values, s)
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("option %q must be a list of strings, got %T", key, raw)
+	}
+	return values, nil
+}
+
+func dataDogConfig(options map[string]interface{}) (datadogbackend.Config, error) {
+	var cfg datadogbackend.Config
+	var err error
+
+	if cfg.Namespace, err = stringOption(options, OptNamespace); err != nil {
+		return cfg, err
+	}
+	if cfg.Address, err = stringOption(options, OptAddress); err != nil {
+		return cfg, err
+	}
+	if cfg.Transport, err = stringOption(options, OptTransport); err != nil {
+		return cfg, err
+	}
+	if cfg.Tags, err = stringSliceOption(options, OptTags); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// backendOptions returns the options for one backend of a fan-out: the
+// top-level options overlaid with the map found under the backend's type.
+func backendOptions(options map[string]interface{}, backendType string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		merged[k] = v
+	}
+
+	raw, ok := options[backendType]
+	if !ok || raw == nil {
+		return merged, nil
+	}
+	own, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("option %q must be a map of %s options, got %T", backendType, backendType, raw)
+	}
+	for k, v := range own {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// otlpConfig reads the OTLP options: address is the receiver endpoint and
+// transport the protocol (grpc or http).
+func otlpConfig(options map[string]interface{}) (otlpbackend.Config, error) {
+	var cfg otlpbackend.Config
+	var err error
+
+	if cfg.Namespace, err = stringOption(options, OptNamespace); err != nil {
+		return cfg, err
+	}
+	if cfg.Endpoint, err = stringOption(options, OptAddress); err != nil {
+		return cfg, err
+	}
+	if cfg.Protocol, err = stringOption(options, OptTransport); err != nil {
+		return cfg, err
+	}
+	if cfg.Insecure, err = boolOption(options, OptInsecure); err != nil {
+		return cfg, err
+	}
+	if cfg.Headers, err = stringMapOption(options, OptHeaders); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval, err = durationOption(options, OptExportInterval); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = durationOption(options, OptExportTimeout); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// remoteWriteConfig reads the remote-write options: address is the receiver
+// URL.
+func remoteWriteConfig(options map[string]interface{}) (remotewritebackend.Config, error) {
+	var cfg remotewritebackend.Config
+	var err error
+
+	if cfg.URL, err = stringOption(options, OptAddress); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval, err = durationOption(options, OptExportInterval); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = durationOption(options, OptExportTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchSize, err = intOption(options, OptBatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.QueueSize, err = intOption(options, OptQueueSize); err != nil {
+		return cfg, err
+	}
+	// Unset takes the default; 0 disables retries
+	cfg.MaxRetries = -1
+	if _, ok := options[OptMaxRetries]; ok {
+		if cfg.MaxRetries, err = intOption(options, OptMaxRetries); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Username, err = stringOption(options, OptUsername); err != nil {
+		return cfg, err
+	}
+	if cfg.Password, err = stringOption(options, OptPassword); err != nil {
+		return cfg, err
+	}
+	if cfg.BearerToken, err = stringOption(options, OptBearerToken); err != nil {
+		return cfg, err
+	}
+	if cfg.Headers, err = stringMapOption(options, OptHeaders); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// influxConfig reads the InfluxDB options: address is the write URL (HTTP)
+// or host:port (UDP), transport http or udp, queue_size the most points kept
+// in the buffer.
+func influxConfig(options map[string]interface{}) (influxbackend.Config, error) {
+	var cfg influxbackend.Config
+	var err error
+
+	if cfg.Address, err = stringOption(options, OptAddress); err != nil {
+		return cfg, err
+	}
+	if cfg.Transport, err = stringOption(options, OptTransport); err != nil {
+		return cfg, err
+	}
+	if cfg.Token, err = stringOption(options, OptToken); err != nil {
+		return cfg, err
+	}
+	if cfg.Username, err = stringOption(options, OptUsername); err != nil {
+		return cfg, err
+	}
+	if cfg.Password, err = stringOption(options, OptPassword); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchSize, err = intOption(options, OptBatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxPending, err = intOption(options, OptQueueSize); err != nil {
+		return cfg, err
+	}
+	if cfg.FlushInterval, err = durationOption(options, OptExportInterval); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = durationOption(options, OptExportTimeout); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func validationOption(options map[string]interface{}) (models.ValidationMode, error) {
+	mode, err := stringOption(options, OptKPIValidation)
+	if err != nil {
+		return "", err
+	}
+	switch models.ValidationMode(mode) {
+	case "", models.ValidationStrict:
+		return models.ValidationStrict, nil
+	case models.ValidationLenient:
+		return models.ValidationLenient, nil
+	default:
+		return "", fmt.Errorf("option %q must be %q or %q, got %q", OptKPIValidation,
+			models.ValidationStrict, models.ValidationLenient, mode)
+	}
+}
+
+// stringMapOption accepts map[string]string, map[string]interface{} with
+// string values, or a "key=value,key=value" string.
+func stringMapOption(options map[string]interface{}, key string) (map[string]string, error) {
+	raw, ok := options[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	values := make(map[string]string)
+	switch v := raw.(type) {
+	case map[string]string:
+		for k, val := range v {
+			values[k] = val
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("option %q must map to strings, got %T for %q", key, item, k)
+			}
+			values[k] = s
+		}
+	case string:
+		for _, pair := range strings.Split(v, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			k, val, found := strings.Cut(pair, "=")
+			if !found {
+				return nil, fmt.Errorf("option %q: %q is not key=value", key, pair)
+			}
+			values[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+	default:
+		return nil, fmt.Errorf("option %q must be a map of strings, got %T", key, raw)
+	}
+	return values, nil
+}
+
+// intOption accepts any Go integer, a whole float64 (as decoded from JSON) or
+// a decimal string.
+func intOption(options map[string]interface{}, key string) (int, error) {
+	raw, ok := options[key]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	switch v := raw.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint:
+		return int(v), nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("option %q must be a whole number, got %v", key, v)
+		}
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("option %q: %w", key, err)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("option %q must be an integer, got %T", key, raw)
+	}
+}
+
+func cardinalityOptions(options map[string]interface{}) (*cardinalityGuard, error) {
+	globalLimit, err := intOption(options, OptMaxSeries)
+	if err != nil {
+		return nil, err
+	}
+	defaultLimit, err := intOption(options, OptMaxSeriesPerMetric)
+	if err != nil {
+		return nil, err
+	}
+	if globalLimit < 0 || defaultLimit < 0 {
+		return nil, fmt.Errorf("options %q and %q must not be negative", OptMaxSeries, OptMaxSeriesPerMetric)
+	}
+
+	policy, err := stringOption(options, OptOverflowPolicy)
+	if err != nil {
+		return nil, err
+	}
+	switch models.OverflowPolicy(policy) {
+	case "", models.OverflowReject, models.OverflowDrop, models.OverflowFold:
+	default:
+		return nil, fmt.Errorf("option %q must be reject, drop or fold, got %q", OptOverflowPolicy, policy)
+	}
+
+	return newCardinalityGuard(globalLimit, defaultLimit, models.OverflowPolicy(policy)), nil
+}
+
+// boolOption accepts a bool or a string understood by strconv.ParseBool.
+func boolOption(options map[string]interface{}, key string) (bool, error) {
+	raw, ok := options[key]
+	if !ok || raw == nil {
+		return false, nil
+	}
+
+	switch v := raw.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("option %q: %w", key, err)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("option %q must be a boolean, got %T", key, raw)
+	}
+}
+
+// durationOption accepts a time.Duration or a duration string such as "15s".
+func durationOption(options map[string]interface{}, key string) (time.Duration, error) {
+	raw, ok := options[key]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	switch v := raw.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("option %q: %w", key, err)
+		}
+		return d, nil
+	default:
+		return 0, fmt.Errorf("option %q must be a duration, got %T", key, raw)
+	}
+}
@@ -0,0 +1,45 @@
+package metrics_wrapper_test
+
+import (
+	"amantya_metrics/metrics_wrapper"
+	"reflect"
+	"testing"
+)
+
+func TestBackendOptions(t *testing.T) {
+	options := map[string]interface{}{
+		"namespace":  "amf",
+		"address":    "localhost:8125",
+		"datadog":    map[string]interface{}{"address": "agent:8125", "tags": []interface{}{"env:lab"}},
+		"prometheus": nil,
+	}
+	tests := []struct {
+		backend string
+		want    map[string]interface{}
+	}{
+		// The backend's own options win over the top-level ones
+		{"datadog", map[string]interface{}{"namespace": "amf", "address": "agent:8125", "tags": []interface{}{"env:lab"}}},
+		{"prometheus", map[string]interface{}{"namespace": "amf", "address": "localhost:8125"}},
+		{"otlp", map[string]interface{}{"namespace": "amf", "address": "localhost:8125"}},
+	}
+	for _, tt := range tests {
+		got, err := metrics_wrapper.BackendOptions(options, tt.backend)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.backend, err)
+		}
+		// The nested maps of every backend are still there for the others
+		delete(got, "datadog")
+		delete(got, "prometheus")
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s options %v, want %v", tt.backend, got, tt.want)
+		}
+	}
+	if options["address"] != "localhost:8125" {
+		t.Error("merging changed the top-level options")
+	}
+
+	_, err := metrics_wrapper.BackendOptions(map[string]interface{}{"otlp": "collector:4317"}, "otlp")
+	if err == nil || err.Error() != `option "otlp" must be a map of otlp options, got string` {
+		t.Errorf("nested option that is not a map: got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/utils"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// checkPermission enforces the increment/decrement flags of the KPI behind a
+// metric. delta is the direction of the change: positive needs "increment",
+// negative needs "decrement" and zero (e.g. InitializeDefaults) needs neither.
+// Set is checked by checkSetPermission; Observe is not directional.
+func (mf *MetricsFramework) checkPermission(name string, delta float64) error {
+	kpi, ok := mf.registry.GetKPI(name)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case delta > 0 && !kpi.Increment:
+		return utils.NewMetricError("increment", name, metricsInterface.ErrOperationNotPermitted)
+	case delta < 0 && !kpi.Decrement:
+		return utils.NewMetricError("decrement", name, metricsInterface.ErrOperationNotPermitted)
+	}
+	return nil
+}
+
+// checkSetPermission applies the same flags to Set by comparing value with
+// the current value of the series: raising it needs "increment" and lowering
+// it needs "decrement". A series that was never written counts as zero.
+func (mf *MetricsFramework) checkSetPermission(name string, metric metricsInterface.Metric, value float64, labels map[string]string) error {
+	kpi, ok := mf.registry.GetKPI(name)
+	if !ok || (kpi.Increment && kpi.Decrement) {
+		return nil
+	}
+
+	var current float64
+	sample, err := metric.Value(labels)
+	switch {
+	case err == nil:
+		current = sample.Value
+	case !errors.Is(err, metricsInterface.ErrSeriesNotFound):
+		return utils.NewMetricError("set", name, err)
+	}
+
+	switch {
+	case value > current && !kpi.Increment:
+		return utils.NewMetricError("set", name,
+			fmt.Errorf("%w: %v is above the current %v", metricsInterface.ErrOperationNotPermitted, value, current))
+	case value < current && !kpi.Decrement:
+		return utils.NewMetricError("set", name,
+			fmt.Errorf("%w: %v is below the current %v", metricsInterface.ErrOperationNotPermitted, value, current))
+	}
+	return nil
+}
+
+// checkLabels verifies the caller's labels against the KPI object list before
+// the update reaches the backend, so every backend rejects mismatches alike.
+func (mf *MetricsFramework) checkLabels(op, name string, labels map[string]string) error {
+	kpi, ok := mf.registry.GetKPI(name)
+	if !ok {
+		return nil
+	}
+
+	if err := metricsInterface.CheckLabels(kpi.Object, labels); err != nil {
+		return utils.NewMetricError(op, name, err)
+	}
+	return nil
+}
+
+// checkLabelSubset verifies that labels is a non-empty subset of the KPI
+// object list, as needed for partial matching.
+func (mf *MetricsFramework) checkLabelSubset(op, name string, labels map[string]string) error {
+	if len(labels) == 0 {
+		return utils.NewMetricError(op, name,
+			fmt.Errorf("%w: at least one label is required", metricsInterface.ErrInvalidLabel))
+	}
+
+	kpi, ok := mf.registry.GetKPI(name)
+	if !ok {
+		return nil
+	}
+	for label := range labels {
+		if !slices.Contains(kpi.Object, label) {
+			return utils.NewMetricError(op, name,
+				fmt.Errorf("%w: unexpected %s", metricsInterface.ErrInvalidLabel, label))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package metrics_wrapper_test
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metricstest"
+	"amantya_metrics/models"
+	"errors"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	type step struct {
+		op      string
+		value   float64
+		allowed bool
+	}
+	tests := []struct {
+		name                 string
+		increment, decrement bool
+		steps                []step
+		want                 float64
+	}{
+		{"increment only", true, false, []step{
+			{"inc", 0, true}, {"add", 2, true}, {"dec", 0, false}, {"add", -1, false},
+			{"set", 5, true}, {"set", 5, true}, {"set", 3, false}, {"set", 8, true},
+		}, 8},
+		{"decrement only", false, true, []step{
+			{"set", 0, true}, {"set", 2, false}, {"inc", 0, false}, {"dec", 0, true}, {"set", -4, true}, {"set", -3, false},
+		}, -4},
+		{"neither", false, false, []step{
+			{"set", 0, true}, {"set", 1, false}, {"set", -1, false}, {"add", 0, true},
+		}, 0},
+		{"both", true, true, []step{
+			{"set", 5, true}, {"set", 2, true}, {"inc", 0, true}, {"dec", 0, true}, {"set", 9, true},
+		}, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, _ := metricstest.NewFramework(t, models.KPI{
+				Name:           "ActiveSessions",
+				DisplayName:    "active_sessions",
+				PrometheusType: "Gauge",
+				Increment:      tt.increment,
+				Decrement:      tt.decrement,
+			})
+
+			for _, s := range tt.steps {
+				var err error
+				switch s.op {
+				case "inc":
+					err = fw.IncrementMetric("active_sessions", nil)
+				case "dec":
+					err = fw.DecrementMetric("active_sessions", nil)
+				case "add":
+					err = fw.AddToMetric("active_sessions", s.value, nil)
+				case "set":
+					err = fw.SetMetric("active_sessions", s.value, nil)
+				}
+				if s.allowed && err != nil {
+					t.Errorf("%s %v: %v", s.op, s.value, err)
+				}
+				if !s.allowed && !errors.Is(err, metricsInterface.ErrOperationNotPermitted) {
+					t.Errorf("%s %v: got %v, want ErrOperationNotPermitted", s.op, s.value, err)
+				}
+			}
+			metricstest.AssertGauge(t, fw, "active_sessions", nil, tt.want)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultPMRetention is the number of period reports a PM job keeps when its
+// configuration does not say: one day of 15 minute periods.
+const DefaultPMRetention = 96
+
+// PMJobConfig describes a performance measurement job collecting every
+// registered KPI per granularity period (TS 28.550), e.g. 5, 15 or 60 minutes.
+type PMJobConfig struct {
+	ID          string
+	Granularity time.Duration
+	// Retention is the number of period reports kept in memory.
+	Retention int
+	// OnReport is called with every completed period report.
+	OnReport []func(PeriodReport)
+}
+
+// PeriodReport holds the values of all KPIs for one granularity period.
+// Counters, histograms and summaries report the increase during the period;
+// gauges report their value at the end of it.
+type PeriodReport struct {
+	Job          string        `json:"job"`
+	Granularity  string        `json:"granularity"`
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	Measurements []Measurement `json:"measurements"`
+}
+
+// Measurement is one metric in a PeriodReport.
+type Measurement struct {
+	Metric     string                      `json:"metric"`
+	KPI        string                      `json:"kpi,omitempty"`
+	NFType     string                      `json:"nf_type,omitempty"`
+	Unit       string                      `json:"unit,omitempty"`
+	Type       metricsInterface.MetricType `json:"type"`
+	LabelNames []string                    `json:"label_names,omitempty"`
+	Series     []metricsInterface.Sample   `json:"series"`
+}
+
+// PMJobStatus describes a running PM job.
+type PMJobStatus struct {
+	ID          string    `json:"id"`
+	Granularity string    `json:"granularity"`
+	Retention   int       `json:"retention"`
+	Reports     int       `json:"reports"`
+	PeriodStart time.Time `json:"period_start"`
+}
+
+type pmJob struct {
+	cfg PMJobConfig
+
+	mu          sync.Mutex
+	reports     []PeriodReport
+	baseline    map[string]map[string]metricsInterface.Sample
+	periodStart time.Time
+	done        chan struct{}
+}
+
+// StartPMJob starts collecting period reports. Periods are aligned to the
+// wall clock, so a 15 minute job closes its periods at :00, :15, :30 and :45;
+// the first period starts now and may be shorter.
+func (mf *MetricsFramework) StartPMJob(cfg PMJobConfig) error {
+	if cfg.Granularity < time.Second {
+		return fmt.Errorf("invalid granularity period %s", cfg.Granularity)
+	}
+	if cfg.ID == "" {
+		cfg.ID = cfg.Granularity.String()
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultPMRetention
+	}
+
+	mf.pmMu.Lock()
+	defer mf.pmMu.Unlock()
+	if _, ok := mf.pmJobs[cfg.ID]; ok {
+		return fmt.Errorf("%w: %s", metricsInterface.ErrJobExists, cfg.ID)
+	}
+
+	job := &pmJob{cfg: cfg, periodStart: time.Now(), done: make(chan struct{})}
+	// Counters start from their current totals so the first period only
+	// reports what happened during it
+	job.measure(mf, true)
+	mf.pmJobs[cfg.ID] = job
+
+	go mf.runPMJob(job)
+	log.Printf("Started PM job %s with %s granularity", cfg.ID, cfg.Granularity)
+	return nil
+}
+
+// StopPMJob stops a PM job and discards its reports.
+func (mf *MetricsFramework) StopPMJob(id string) error {
+	mf.pmMu.Lock()
+	defer mf.pmMu.Unlock()
+
+	job, ok := mf.pmJobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", metricsInterface.ErrJobNotFound, id)
+	}
+	close(job.done)
+	delete(mf.pmJobs, id)
+	return nil
+}
+
+// PMJobs lists the running PM jobs, sorted by ID.
+func (mf *MetricsFramework) PMJobs() []PMJobStatus {
+	mf.pmMu.Lock()
+	jobs := make([]*pmJob, 0, len(mf.pmJobs))
+	for _, job := range mf.pmJobs {
+		jobs = append(jobs, job)
+	}
+	mf.pmMu.Unlock()
+
+	statuses := make([]PMJobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		job.mu.Lock()
+		statuses = append(statuses, PMJobStatus{
+			ID:          job.cfg.ID,
+			Granularity: job.cfg.Granularity.String(),
+			Retention:   job.cfg.Retention,
+			Reports:     len(job.reports),
+			PeriodStart: job.periodStart,
+		})
+		job.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// PMReports returns the kept period reports of a job, oldest first.
+func (mf *MetricsFramework) PMReports(id string) ([]PeriodReport, error) {
+	job, err := mf.pmJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return append([]PeriodReport(nil), job.reports...), nil
+}
+
+// ClosePMPeriod ends the current period of a job now, as if its granularity
+// period had elapsed, and returns the report.
+func (mf *MetricsFramework) ClosePMPeriod(id string) (PeriodReport, error) {
+	job, err := mf.pmJob(id)
+	if err != nil {
+		return PeriodReport{}, err
+	}
+	return mf.closePeriod(job, time.Now()), nil
+}
+
+func (mf *MetricsFramework) pmJob(id string) (*pmJob, error) {
+	mf.pmMu.Lock()
+	defer mf.pmMu.Unlock()
+
+	job, ok := mf.pmJobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", metricsInterface.ErrJobNotFound, id)
+	}
+	return job, nil
+}
+
+func (mf *MetricsFramework) stopPMJobs() {
+	mf.pmMu.Lock()
+	defer mf.pmMu.Unlock()
+
+	for id, job := range mf.pmJobs {
+		close(job.done)
+		delete(mf.pmJobs, id)
+	}
+}
+
+func (mf *MetricsFramework) runPMJob(job *pmJob) {
+	granularity := job.cfg.Granularity
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(granularity).Add(granularity).Sub(now))
+		select {
+		case end := <-timer.C:
+			mf.closePeriod(job, end.Truncate(granularity))
+		case <-job.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (mf *MetricsFramework) closePeriod(job *pmJob, end time.Time) PeriodReport {
+	if err := mf.refreshDerived(""); err != nil {
+		log.Printf("PM job %s: %v", job.cfg.ID, err)
+	}
+
+	job.mu.Lock()
+	report := PeriodReport{
+		Job:          job.cfg.ID,
+		Granularity:  job.cfg.Granularity.String(),
+		Start:        job.periodStart,
+		End:          end,
+		Measurements: job.measure(mf, false),
+	}
+	job.periodStart = end
+	job.reports = append(job.reports, report)
+	if extra := len(job.reports) - job.cfg.Retention; extra > 0 {
+		job.reports = append([]PeriodReport(nil), job.reports[extra:]...)
+	}
+	job.mu.Unlock()
+
+	for _, fn := range job.cfg.OnReport {
+		fn(report)
+	}
+	return report
+}
+
+// measure reads every registered metric, turning cumulative values into the
+// increase since the previous call, and records the new baseline. With
+// baselineOnly no measurements are built.
+func (job *pmJob) measure(mf *MetricsFramework, baselineOnly bool) []Measurement {
+	baseline := make(map[string]map[string]metricsInterface.Sample)
+	var measurements []Measurement
+
+	for _, name := range mf.registry.List() {
+		metric, err := mf.registry.Get(name)
+		if err != nil {
+			continue
+		}
+		samples, err := metric.Series()
+		if err != nil {
+			log.Printf("PM job %s: failed to read %s: %v", job.cfg.ID, name, err)
+			continue
+		}
+
+		metricType := metric.GetMetricType()
+		cumulative := metricType != metricsInterface.GaugeType
+		current := make(map[string]metricsInterface.Sample, len(samples))
+		for i, sample := range samples {
+			key := metricsInterface.SeriesKey(sample.Labels)
+			current[key] = sample
+			if prev, ok := job.baseline[name][key]; ok && cumulative {
+				samples[i] = increase(prev, sample)
+			}
+		}
+		baseline[name] = current
+		if baselineOnly {
+			continue
+		}
+
+		m := Measurement{Metric: name, Type: metricType, Series: samples}
+		if kpi, ok := mf.registry.GetKPI(name); ok {
+			m.KPI, m.NFType, m.Unit, m.LabelNames = kpi.Name, kpi.NFType, kpi.Unit, kpi.Object
+		}
+		measurements = append(measurements, m)
+	}
+
+	job.baseline = baseline
+	return measurements
+}
+
+// increase returns the change from prev to cur. A decrease means the series
+// was reset or recreated, so cur is the increase since then.
+func increase(prev, cur metricsInterface.Sample) metricsInterface.Sample {
+	if cur.Value < prev.Value || cur.Count < prev.Count {
+		return cur
+	}
+	cur.Value -= prev.Value
+	cur.Count -= prev.Count
+	cur.Sum -= prev.Sum
+	return cur
+}
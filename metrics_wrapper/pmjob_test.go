@@ -0,0 +1,156 @@
+package metrics_wrapper_test
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/metricstest"
+	"amantya_metrics/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	sessions = models.KPI{
+		Name:           "ActiveSessions",
+		DisplayName:    "sessions",
+		PrometheusType: "Gauge",
+		Increment:      true,
+		Decrement:      true,
+	}
+	setupTime = models.KPI{
+		Name:           "SetupTime",
+		DisplayName:    "setup_time",
+		PrometheusType: "Histogram",
+		Buckets:        []float64{1},
+	}
+)
+
+// startJob starts an hourly PM job, so its periods only close through
+// ClosePMPeriod.
+func startJob(t *testing.T, fw *metrics_wrapper.MetricsFramework, retention int) {
+	t.Helper()
+
+	if err := fw.StartPMJob(metrics_wrapper.PMJobConfig{ID: "job1", Granularity: time.Hour, Retention: retention}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func closePeriod(t *testing.T, fw *metrics_wrapper.MetricsFramework) metrics_wrapper.PeriodReport {
+	t.Helper()
+
+	report, err := fw.ClosePMPeriod("job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// series returns the samples of metric in report keyed by the Result label.
+func series(t *testing.T, report metrics_wrapper.PeriodReport, metric string) map[string]metricsInterface.Sample {
+	t.Helper()
+
+	for _, m := range report.Measurements {
+		if m.Metric == metric {
+			samples := make(map[string]metricsInterface.Sample)
+			for _, s := range m.Series {
+				samples[s.Labels["Result"]] = s
+			}
+			return samples
+		}
+	}
+	t.Fatalf("%s is not in the report", metric)
+	return nil
+}
+
+func TestPMJobPeriods(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, attempts, sessions, setupTime)
+	success := map[string]string{"Result": "Success"}
+	failure := map[string]string{"Result": "Failure"}
+
+	// What happened before the job started is not reported
+	fw.AddToMetric("attempts", 5, success)
+	fw.SetMetric("sessions", 7, nil)
+	startJob(t, fw, 0)
+
+	fw.AddToMetric("attempts", 3, success)
+	fw.IncrementMetric("attempts", failure)
+	fw.DecrementMetric("sessions", nil)
+	fw.ObserveMetric("setup_time", 0.5, nil)
+	fw.ObserveMetric("setup_time", 1.5, nil)
+	report := closePeriod(t, fw)
+	if report.Job != "job1" || report.Granularity != "1h0m0s" || report.End.Before(report.Start) {
+		t.Errorf("report %s %s from %s to %s", report.Job, report.Granularity, report.Start, report.End)
+	}
+	if got := series(t, report, "attempts"); got["Success"].Value != 3 || got["Failure"].Value != 1 {
+		t.Errorf("first period attempts %v, want Success 3 and Failure 1", got)
+	}
+	if got := series(t, report, "sessions")[""]; got.Value != 6 {
+		t.Errorf("first period sessions %v, want the end value 6", got.Value)
+	}
+	if got := series(t, report, "setup_time")[""]; got.Count != 2 || got.Sum != 2 {
+		t.Errorf("first period setup_time count %d sum %v, want 2 and 2", got.Count, got.Sum)
+	}
+
+	// The Success series is recreated below its previous total, so all of
+	// the new total counts as the increase
+	fw.DeleteSeries("attempts", success)
+	fw.AddToMetric("attempts", 2, success)
+	fw.IncrementMetric("attempts", failure)
+	fw.ObserveMetric("setup_time", 0.25, nil)
+	report = closePeriod(t, fw)
+	if got := series(t, report, "attempts"); got["Success"].Value != 2 || got["Failure"].Value != 1 {
+		t.Errorf("second period attempts %v, want Success 2 and Failure 1", got)
+	}
+	if got := series(t, report, "sessions")[""]; got.Value != 6 {
+		t.Errorf("second period sessions %v, want the unchanged 6", got.Value)
+	}
+	if got := series(t, report, "setup_time")[""]; got.Count != 1 || got.Sum != 0.25 {
+		t.Errorf("second period setup_time count %d sum %v, want 1 and 0.25", got.Count, got.Sum)
+	}
+}
+
+func TestPMJobRetention(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, attempts)
+	startJob(t, fw, 2)
+
+	var ends []time.Time
+	for range 3 {
+		ends = append(ends, closePeriod(t, fw).End)
+	}
+	reports, err := fw.PMReports("job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || !reports[0].End.Equal(ends[1]) || !reports[1].End.Equal(ends[2]) {
+		t.Errorf("kept %d reports, want the last two of three", len(reports))
+	}
+	if jobs := fw.PMJobs(); len(jobs) != 1 || jobs[0].Reports != 2 || jobs[0].Retention != 2 {
+		t.Errorf("PMJobs() = %+v", jobs)
+	}
+}
+
+func TestPMJobErrors(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, attempts)
+	startJob(t, fw, 0)
+
+	if err := fw.StartPMJob(metrics_wrapper.PMJobConfig{ID: "job1", Granularity: time.Minute}); !errors.Is(err, metricsInterface.ErrJobExists) {
+		t.Errorf("starting job1 again: got %v, want ErrJobExists", err)
+	}
+	if err := fw.StopPMJob("job2"); !errors.Is(err, metricsInterface.ErrJobNotFound) {
+		t.Errorf("stopping an unknown job: got %v, want ErrJobNotFound", err)
+	}
+	if _, err := fw.ClosePMPeriod("job2"); !errors.Is(err, metricsInterface.ErrJobNotFound) {
+		t.Errorf("closing a period of an unknown job: got %v, want ErrJobNotFound", err)
+	}
+	if err := fw.StartPMJob(metrics_wrapper.PMJobConfig{ID: "job2", Granularity: time.Millisecond}); err == nil {
+		t.Error("started a job with a granularity below one second")
+	}
+
+	if err := fw.StopPMJob("job1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.PMReports("job1"); !errors.Is(err, metricsInterface.ErrJobNotFound) {
+		t.Errorf("reports of a stopped job: got %v, want ErrJobNotFound", err)
+	}
+}
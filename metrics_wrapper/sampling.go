@@ -0,0 +1,234 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statistics exposed by a sampling gauge. The KPI's own statistic is served
+// under the metric name, the other two under <name>_<stat>.
+const (
+	StatMean = "mean"
+	StatMax  = "max"
+	StatMin  = "min"
+)
+
+type sampledSeries struct {
+	labels   map[string]string
+	level    float64
+	sum      float64
+	count    int
+	max, min float64
+}
+
+// samplingGauge implements the Mean, Max and Min KPI types. Callers maintain
+// a level with the usual gauge operations; every sample interval the level of
+// each series is recorded and the mean, max and min over the current
+// observation period are published as backend gauges.
+type samplingGauge struct {
+	primary string
+	stats   map[string]metricsInterface.Metric
+	period  time.Duration
+
+	mu          sync.Mutex
+	series      map[string]*sampledSeries
+	periodStart time.Time
+	sampler     *janitor
+}
+
+func newSamplingGauge(backend metricsInterface.Backend, name string, kpi models.KPI) (*samplingGauge, error) {
+	interval, period, err := kpi.Sampling()
+	if err != nil {
+		return nil, err
+	}
+
+	sg := &samplingGauge{
+		primary: strings.ToLower(kpi.Type),
+		stats:   make(map[string]metricsInterface.Metric),
+		period:  period,
+		series:  make(map[string]*sampledSeries),
+		sampler: &janitor{},
+	}
+	extra := kpi.StatisticNames()
+	for _, stat := range []string{StatMean, StatMax, StatMin} {
+		statName, help := name, kpi.Description
+		if extraName, ok := extra[stat]; ok {
+			statName = extraName
+			help = strings.TrimSpace(fmt.Sprintf("%s (%s over the observation period)", kpi.Description, stat))
+		}
+		gauge, err := backend.NewGauge(statName, help, kpi.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", statName, err)
+		}
+		sg.stats[stat] = gauge
+	}
+
+	sg.sampler.start(interval, func() { sg.sample(time.Now()) })
+	return sg, nil
+}
+
+func (sg *samplingGauge) update(labels map[string]string, fn func(float64) float64) {
+	key := metricsInterface.SeriesKey(labels)
+
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	s, ok := sg.series[key]
+	if !ok {
+		copied := make(map[string]string, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &sampledSeries{labels: copied}
+		sg.series[key] = s
+	}
+	s.level = fn(s.level)
+}
+
+// sample records the current level of every series, starting a new
+// observation period when the previous one has ended.
+func (sg *samplingGauge) sample(now time.Time) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if now.Sub(sg.periodStart) >= sg.period {
+		sg.periodStart = now.Truncate(sg.period)
+		for _, s := range sg.series {
+			s.sum, s.count = 0, 0
+		}
+	}
+
+	for _, s := range sg.series {
+		if s.count == 0 || s.level > s.max {
+			s.max = s.level
+		}
+		if s.count == 0 || s.level < s.min {
+			s.min = s.level
+		}
+		s.sum += s.level
+		s.count++
+
+		for stat, value := range map[string]float64{StatMean: s.sum / float64(s.count), StatMax: s.max, StatMin: s.min} {
+			if err := sg.stats[stat].Set(value, s.labels); err != nil {
+				log.Printf("Failed to publish %s sample: %v", stat, err)
+			}
+		}
+	}
+}
+
+// value is the KPI's statistic for the period so far, or the level itself
+// before the first sample.
+func (sg *samplingGauge) value(s *sampledSeries) float64 {
+	if s.count == 0 {
+		return s.level
+	}
+	switch sg.primary {
+	case StatMax:
+		return s.max
+	case StatMin:
+		return s.min
+	default:
+		return s.sum / float64(s.count)
+	}
+}
+
+func (sg *samplingGauge) stop() {
+	sg.sampler.stop()
+}
+
+func stopSampler(metric metricsInterface.Metric) {
+	if sg, ok := metric.(*samplingGauge); ok {
+		sg.stop()
+	}
+}
+
+func (sg *samplingGauge) Inc(labels map[string]string) error {
+	return sg.Add(1, labels)
+}
+
+func (sg *samplingGauge) Dec(labels map[string]string) error {
+	return sg.Add(-1, labels)
+}
+
+func (sg *samplingGauge) Add(value float64, labels map[string]string) error {
+	sg.update(labels, func(level float64) float64 { return level + value })
+	return nil
+}
+
+func (sg *samplingGauge) Set(value float64, labels map[string]string) error {
+	sg.update(labels, func(float64) float64 { return value })
+	return nil
+}
+
+func (sg *samplingGauge) Observe(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (sg *samplingGauge) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.GaugeType
+}
+
+func (sg *samplingGauge) DeleteSeries(labels map[string]string) bool {
+	sg.mu.Lock()
+	key := metricsInterface.SeriesKey(labels)
+	_, ok := sg.series[key]
+	delete(sg.series, key)
+	sg.mu.Unlock()
+
+	for _, stat := range sg.stats {
+		stat.DeleteSeries(labels)
+	}
+	return ok
+}
+
+func (sg *samplingGauge) DeletePartialMatch(labels map[string]string) int {
+	sg.mu.Lock()
+	deleted := 0
+	for key, s := range sg.series {
+		if metricsInterface.MatchesLabels(s.labels, labels) {
+			delete(sg.series, key)
+			deleted++
+		}
+	}
+	sg.mu.Unlock()
+
+	for _, stat := range sg.stats {
+		stat.DeletePartialMatch(labels)
+	}
+	return deleted
+}
+
+func (sg *samplingGauge) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	s, ok := sg.series[metricsInterface.SeriesKey(labels)]
+	if !ok {
+		return metricsInterface.Sample{}, metricsInterface.ErrSeriesNotFound
+	}
+	return metricsInterface.Sample{Labels: s.labels, Value: sg.value(s)}, nil
+}
+
+func (sg *samplingGauge) Series() ([]metricsInterface.Sample, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	keys := make([]string, 0, len(sg.series))
+	for key := range sg.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]metricsInterface.Sample, 0, len(keys))
+	for _, key := range keys {
+		s := sg.series[key]
+		samples = append(samples, metricsInterface.Sample{Labels: s.labels, Value: sg.value(s)})
+	}
+	return samples, nil
+}
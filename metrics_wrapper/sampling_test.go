@@ -0,0 +1,133 @@
+package metrics_wrapper_test
+
+import (
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/metricstest"
+	"amantya_metrics/models"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampledKPI samples hourly so the sampler never fires during a test; the
+// tests take their samples with SampleAt.
+func sampledKPI(kpiType string) models.KPI {
+	return models.KPI{
+		Name:           "ActiveSessions",
+		DisplayName:    "active_sessions",
+		Type:           kpiType,
+		Object:         []string{"NetworkSlice"},
+		Increment:      true,
+		Decrement:      true,
+		SampleInterval: "1h",
+		Period:         "1h",
+	}
+}
+
+// lastSet returns the value the backend gauge name was last set to.
+func lastSet(t *testing.T, backend *metricstest.Backend, name string) float64 {
+	t.Helper()
+
+	calls := backend.CallsFor(name)
+	if len(calls) == 0 {
+		t.Fatalf("%s was never published", name)
+	}
+	return calls[len(calls)-1].Value
+}
+
+func TestSamplingStatistics(t *testing.T) {
+	fw, backend := metricstest.NewFramework(t, sampledKPI(models.TypeMean))
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for i, level := range []float64{2, 6, 4} {
+		if err := fw.SetMetric("active_sessions", level, slice1); err != nil {
+			t.Fatal(err)
+		}
+		metrics_wrapper.SampleAt(fw, "active_sessions", start.Add(time.Duration(i)*20*time.Minute))
+	}
+	metricstest.AssertGauge(t, fw, "active_sessions", slice1, 4)
+	for name, want := range map[string]float64{"active_sessions": 4, "active_sessions_max": 6, "active_sessions_min": 2} {
+		if got := lastSet(t, backend, name); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+
+	// The next period starts over from its first sample
+	if err := fw.SetMetric("active_sessions", 10, slice1); err != nil {
+		t.Fatal(err)
+	}
+	metrics_wrapper.SampleAt(fw, "active_sessions", start.Add(time.Hour))
+	metricstest.AssertGauge(t, fw, "active_sessions", slice1, 10)
+	for _, name := range []string{"active_sessions", "active_sessions_max", "active_sessions_min"} {
+		if got := lastSet(t, backend, name); got != 10 {
+			t.Errorf("%s = %v after the rollover, want 10", name, got)
+		}
+	}
+}
+
+func TestSamplingPrimaryStatistic(t *testing.T) {
+	tests := []struct {
+		kpiType string
+		want    float64
+		extra   []string
+	}{
+		{models.TypeMean, 4, []string{"active_sessions_max", "active_sessions_min"}},
+		{models.TypeMax, 6, []string{"active_sessions_mean", "active_sessions_min"}},
+		{models.TypeMin, 2, []string{"active_sessions_max", "active_sessions_mean"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kpiType, func(t *testing.T) {
+			fw, backend := metricstest.NewFramework(t, sampledKPI(tt.kpiType))
+			// The KPI's own statistic has no <name>_<stat> gauge
+			var extra []string
+			for _, name := range backend.Metrics() {
+				if strings.HasPrefix(name, "active_sessions_") {
+					extra = append(extra, name)
+				}
+			}
+			if !slices.Equal(extra, tt.extra) {
+				t.Errorf("statistic gauges %v, want %v", extra, tt.extra)
+			}
+
+			slice1 := map[string]string{"NetworkSlice": "slice1"}
+			start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+			for i, level := range []float64{2, 6, 4} {
+				fw.SetMetric("active_sessions", level, slice1)
+				metrics_wrapper.SampleAt(fw, "active_sessions", start.Add(time.Duration(i)*time.Minute))
+			}
+			metricstest.AssertGauge(t, fw, "active_sessions", slice1, tt.want)
+		})
+	}
+}
+
+func TestSamplingValueBeforeFirstSample(t *testing.T) {
+	fw, backend := metricstest.NewFramework(t, sampledKPI(models.TypeMax))
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+
+	if err := fw.SetMetric("active_sessions", 3, slice1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.IncrementMetric("active_sessions", slice1); err != nil {
+		t.Fatal(err)
+	}
+	metricstest.AssertGauge(t, fw, "active_sessions", slice1, 4)
+	if calls := backend.CallsFor("active_sessions"); len(calls) != 0 {
+		t.Errorf("published %v before the first sample", calls)
+	}
+}
+
+func TestSamplerStopsOnClose(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, sampledKPI(models.TypeMean))
+
+	if !metrics_wrapper.SamplerRunning(fw, "active_sessions") {
+		t.Fatal("sampler not started")
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if metrics_wrapper.SamplerRunning(fw, "active_sessions") {
+		t.Error("sampler still running after Close")
+	}
+}
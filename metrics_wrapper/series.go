@@ -0,0 +1,197 @@
+package metrics_wrapper
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/utils"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	minExpiryInterval = time.Second
+	maxExpiryInterval = time.Minute
+)
+
+// DeleteSeries removes the series of a metric with exactly these labels, e.g.
+// once the PDU session or slice it describes is gone. The labels are matched
+// as recorded, after any label_values normalization.
+func (mf *MetricsFramework) DeleteSeries(name string, labels map[string]string) error {
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return err
+	}
+	metric, err := mf.registry.Get(resolved)
+	if err != nil {
+		return err
+	}
+	if err := mf.checkLabels("delete", resolved, labels); err != nil {
+		return err
+	}
+
+	deleted := metric.DeleteSeries(labels)
+	if mf.cardinality.remove(resolved, labels) {
+		deleted = true
+	}
+	if !deleted {
+		return utils.NewMetricError("delete", resolved, metricsInterface.ErrSeriesNotFound)
+	}
+	return nil
+}
+
+// DeletePartialMatch removes every series of a metric whose labels include the
+// given ones, e.g. all series of a removed slice, and returns how many the
+// backend removed.
+func (mf *MetricsFramework) DeletePartialMatch(name string, labels map[string]string) (int, error) {
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return 0, err
+	}
+	metric, err := mf.registry.Get(resolved)
+	if err != nil {
+		return 0, err
+	}
+	if err := mf.checkLabelSubset("delete", resolved, labels); err != nil {
+		return 0, err
+	}
+
+	deleted := metric.DeletePartialMatch(labels)
+	mf.cardinality.removeMatching(resolved, labels)
+	return deleted, nil
+}
+
+// GetMetricValue returns the current value of the series of a metric with
+// exactly these labels.
+func (mf *MetricsFramework) GetMetricValue(name string, labels map[string]string) (metricsInterface.Sample, error) {
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return metricsInterface.Sample{}, err
+	}
+	metric, err := mf.registry.Get(resolved)
+	if err != nil {
+		return metricsInterface.Sample{}, err
+	}
+	if err := mf.checkLabels("read", resolved, labels); err != nil {
+		return metricsInterface.Sample{}, err
+	}
+	if err := mf.refreshDerived(resolved); err != nil {
+		return metricsInterface.Sample{}, utils.NewMetricError("read", resolved, err)
+	}
+
+	sample, err := metric.Value(labels)
+	if err != nil {
+		return metricsInterface.Sample{}, utils.NewMetricError("read", resolved, err)
+	}
+	return sample, nil
+}
+
+// GetMetricSeries returns every series of a metric with its current value.
+func (mf *MetricsFramework) GetMetricSeries(name string) ([]metricsInterface.Sample, error) {
+	resolved, err := mf.registry.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := mf.registry.Get(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if err := mf.refreshDerived(resolved); err != nil {
+		return nil, utils.NewMetricError("read", resolved, err)
+	}
+
+	samples, err := metric.Series()
+	if err != nil {
+		return nil, utils.NewMetricError("read", resolved, err)
+	}
+	return samples, nil
+}
+
+// ExpireSeries deletes the series of metrics with a series_ttl that were not
+// written within it and returns how many were removed. It runs periodically
+// once such metrics are registered.
+func (mf *MetricsFramework) ExpireSeries() int {
+	return mf.cardinality.expire(time.Now(), func(name string, labels map[string]string) {
+		if metric, err := mf.registry.Get(name); err == nil {
+			metric.DeleteSeries(labels)
+		}
+	})
+}
+
+// Close stops background work: series expiry, derived KPI evaluation,
+// sampling and PM jobs. Backends that export on their own, such as OTLP, are
+// flushed and shut down.
+func (mf *MetricsFramework) Close() error {
+	mf.janitor.stop()
+	mf.derived.stop()
+	mf.stopPMJobs()
+	for _, name := range mf.registry.List() {
+		if metric, err := mf.registry.Get(name); err == nil {
+			stopSampler(metric)
+		}
+	}
+	if closer, ok := mf.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// startExpiry (re)starts the expiry loop at half the shortest series_ttl.
+func (mf *MetricsFramework) startExpiry() {
+	ttl := mf.cardinality.minTTL()
+	if ttl == 0 {
+		mf.janitor.stop()
+		return
+	}
+
+	interval := min(max(ttl/2, minExpiryInterval), maxExpiryInterval)
+	mf.janitor.start(interval, func() {
+		if n := mf.ExpireSeries(); n > 0 {
+			log.Printf("Expired %d stale series", n)
+		}
+	})
+}
+
+// janitor runs a function on a fixed interval until stopped.
+type janitor struct {
+	mu       sync.Mutex
+	interval time.Duration
+	done     chan struct{}
+}
+
+func (j *janitor) start(interval time.Duration, fn func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.done != nil {
+		if j.interval == interval {
+			return
+		}
+		close(j.done)
+	}
+
+	done := make(chan struct{})
+	j.done, j.interval = done, interval
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func (j *janitor) stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.done != nil {
+		close(j.done)
+		j.done = nil
+	}
+}
@@ -2,21 +2,78 @@ package metricsregistry
 
 import (
 	"amantya_metrics/metricsInterface"
+	"amantya_metrics/models"
 	"sync"
 )
 
+type entry struct {
+	metric metricsInterface.Metric
+	kpi    *models.KPI
+}
+
 type Registry struct {
-	metrics map[string]metricsInterface.Metric
+	metrics map[string]entry
+	aliases map[string]string
 	mu      sync.RWMutex
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
-		metrics: make(map[string]metricsInterface.Metric),
+		metrics: make(map[string]entry),
+		aliases: make(map[string]string),
 	}
 }
 
 func (r *Registry) Register(name string, metric metricsInterface.Metric) error {
+	return r.register(name, entry{metric: metric})
+}
+
+// RegisterKPI registers the metric together with the KPI it was created
+// from, so operations can be checked against the KPI definition. The KPI
+// name, display name and legacy metric name become aliases that Resolve
+// accepts.
+func (r *Registry) RegisterKPI(name string, metric metricsInterface.Metric, kpi models.KPI) error {
+	if err := r.register(name, entry{metric: metric, kpi: &kpi}); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, alias := range []string{kpi.Name, kpi.DisplayName, models.NormalizeMetricName(kpi.Name),
+		models.LegacyMetricName(kpi.DisplayName)} {
+		if _, taken := r.aliases[alias]; alias != "" && alias != name && !taken {
+			r.aliases[alias] = name
+		}
+	}
+	return nil
+}
+
+// Resolve maps a metric reference to the registered metric name. The
+// reference may be the registered name, a KPI name or display name, or
+// anything that normalizes to one of those.
+func (r *Registry) Resolve(ref string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name, ok := r.resolve(ref); ok {
+		return name, nil
+	}
+	return "", metricsInterface.ErrMetricNotFound
+}
+
+func (r *Registry) resolve(ref string) (string, bool) {
+	for _, candidate := range []string{ref, models.NormalizeMetricName(ref)} {
+		if _, exists := r.metrics[candidate]; exists {
+			return candidate, true
+		}
+		if name, exists := r.aliases[candidate]; exists {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (r *Registry) register(name string, e entry) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -24,7 +81,7 @@ func (r *Registry) Register(name string, metric metricsInterface.Metric) error {
 		return metricsInterface.ErrMetricAlreadyRegistered
 	}
 
-	r.metrics[name] = metric
+	r.metrics[name] = e
 	return nil
 }
 
@@ -32,13 +89,26 @@ func (r *Registry) Get(name string) (metricsInterface.Metric, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	if metric, exists := r.metrics[name]; exists {
-		return metric, nil
+	if resolved, ok := r.resolve(name); ok {
+		return r.metrics[resolved].metric, nil
 	}
 
 	return nil, metricsInterface.ErrMetricNotFound
 }
 
+// GetKPI returns the KPI definition of a metric registered with RegisterKPI.
+// The boolean is false if the metric is unknown or has no KPI attached.
+func (r *Registry) GetKPI(name string) (models.KPI, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if resolved, ok := r.resolve(name); ok && r.metrics[resolved].kpi != nil {
+		return *r.metrics[resolved].kpi, true
+	}
+
+	return models.KPI{}, false
+}
+
 func (r *Registry) List() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -55,10 +125,16 @@ func (r *Registry) Unregister(name string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.metrics[name]; !exists {
+	resolved, ok := r.resolve(name)
+	if !ok {
 		return metricsInterface.ErrMetricNotFound
 	}
 
-	delete(r.metrics, name)
+	delete(r.metrics, resolved)
+	for alias, target := range r.aliases {
+		if target == resolved {
+			delete(r.aliases, alias)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,119 @@
+package metricstest
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/models"
+	"errors"
+	"testing"
+)
+
+// NewFramework returns a framework over a fresh in-memory Backend with the
+// given KPIs registered. The framework is closed when the test ends.
+func NewFramework(t testing.TB, kpis ...models.KPI) (*metrics_wrapper.MetricsFramework, *Backend) {
+	t.Helper()
+
+	backend := NewBackend()
+	fw, err := metrics_wrapper.MetricsWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("metricstest: %v", err)
+	}
+	t.Cleanup(func() { fw.Close() })
+
+	if err := fw.SetKPIs(kpis); err != nil {
+		t.Fatalf("metricstest: %v", err)
+	}
+	if err := fw.RegisterMetrics(); err != nil {
+		t.Fatalf("metricstest: %v", err)
+	}
+	return fw, backend
+}
+
+// AssertCounter checks that the counter series with exactly these labels
+// has the value want.
+func AssertCounter(t testing.TB, fw *metrics_wrapper.MetricsFramework, name string, labels map[string]string, want float64) {
+	t.Helper()
+	assertValue(t, fw, metricsInterface.CounterType, name, labels, want)
+}
+
+// AssertGauge checks that the gauge series with exactly these labels has the
+// value want.
+func AssertGauge(t testing.TB, fw *metrics_wrapper.MetricsFramework, name string, labels map[string]string, want float64) {
+	t.Helper()
+	assertValue(t, fw, metricsInterface.GaugeType, name, labels, want)
+}
+
+func assertValue(t testing.TB, fw *metrics_wrapper.MetricsFramework, metricType metricsInterface.MetricType, name string, labels map[string]string, want float64) {
+	t.Helper()
+
+	sample, ok := value(t, fw, metricType, name, labels)
+	if ok && sample.Value != want {
+		t.Errorf("%s %s %v = %v, want %v", metricType, name, labels, sample.Value, want)
+	}
+}
+
+// AssertObservations checks the number and sum of the observations of a
+// histogram or summary series.
+func AssertObservations(t testing.TB, fw *metrics_wrapper.MetricsFramework, name string, labels map[string]string, count uint64, sum float64) {
+	t.Helper()
+
+	sample, ok := value(t, fw, "", name, labels)
+	if !ok {
+		return
+	}
+	if sample.Count != count || sample.Sum != sum {
+		t.Errorf("%s %v has %d observations summing to %v, want %d summing to %v",
+			name, labels, sample.Count, sample.Sum, count, sum)
+	}
+}
+
+// value reads a series, failing the test if it is missing or the metric is
+// not of metricType ("" accepts histograms and summaries).
+func value(t testing.TB, fw *metrics_wrapper.MetricsFramework, metricType metricsInterface.MetricType, name string, labels map[string]string) (metricsInterface.Sample, bool) {
+	t.Helper()
+
+	resolved, err := fw.ResolveMetric(name)
+	if err != nil {
+		t.Errorf("reading %s: %v", name, err)
+		return metricsInterface.Sample{}, false
+	}
+	if metric, err := fw.GetMetric(resolved); err == nil {
+		got := metric.GetMetricType()
+		switch {
+		case metricType == "" && got != metricsInterface.HistogramType && got != metricsInterface.SummaryType:
+			t.Errorf("%s is a %s, want a histogram or summary", name, got)
+			return metricsInterface.Sample{}, false
+		case metricType != "" && got != metricType:
+			t.Errorf("%s is a %s, want a %s", name, got, metricType)
+			return metricsInterface.Sample{}, false
+		}
+	}
+
+	sample, err := fw.GetMetricValue(name, labels)
+	switch {
+	case errors.Is(err, metricsInterface.ErrSeriesNotFound):
+		t.Errorf("%s %v has no series", name, labels)
+		return sample, false
+	case err != nil:
+		t.Errorf("reading %s %v: %v", name, labels, err)
+		return sample, false
+	}
+	return sample, true
+}
+
+// AssertNoSeries checks that the metric has no series whose labels include
+// the given ones; with no labels, that it has no series at all.
+func AssertNoSeries(t testing.TB, fw *metrics_wrapper.MetricsFramework, name string, labels map[string]string) {
+	t.Helper()
+
+	series, err := fw.GetMetricSeries(name)
+	if err != nil {
+		t.Errorf("reading %s: %v", name, err)
+		return
+	}
+	for _, s := range series {
+		if metricsInterface.MatchesLabels(s.Labels, labels) {
+			t.Errorf("%s has series %v, want none matching %v", name, s.Labels, labels)
+		}
+	}
+}
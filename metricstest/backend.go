@@ -0,0 +1,294 @@
+// Package metricstest lets code that embeds the framework unit-test its
+// instrumentation without a Pushgateway or DogStatsD agent: an in-memory
+// backend that records every call, and assertions on a MetricsFramework.
+package metricstest
+
+import (
+	"amantya_metrics/metricsInterface"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Call is one operation received by a metric of the Backend.
+type Call struct {
+	Metric string
+	Op     string // Inc, Dec, Add, Set or Observe
+	Value  float64
+	Labels map[string]string
+	Err    error
+}
+
+// Descriptor is what the framework passed when it created a metric.
+type Descriptor struct {
+	Name        string
+	Help        string
+	Type        metricsInterface.MetricType
+	Labels      []string
+	ConstLabels map[string]string
+	Buckets     []float64
+	Objectives  map[float64]float64
+	MaxAge      time.Duration
+}
+
+// recorder is shared by a Backend and its const-label views.
+type recorder struct {
+	mu      sync.Mutex
+	metrics map[string]*Metric
+	calls   []Call
+	pushes  int
+}
+
+// Backend is an in-memory metricsInterface.Backend. Its metrics behave like
+// the Prometheus ones: counters only go up, Set and Observe are limited to
+// gauges and histograms/summaries, and labels must match the declared ones.
+type Backend struct {
+	rec         *recorder
+	constLabels map[string]string
+}
+
+func NewBackend() *Backend {
+	return &Backend{rec: &recorder{metrics: make(map[string]*Metric)}}
+}
+
+func (b *Backend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	return &Backend{rec: b.rec, constLabels: maps.Clone(labels)}
+}
+
+func (b *Backend) newMetric(d Descriptor) (metricsInterface.Metric, error) {
+	d.ConstLabels = b.constLabels
+
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+
+	if existing, ok := b.rec.metrics[d.Name]; ok {
+		if existing.desc.Type != d.Type {
+			return nil, fmt.Errorf("%w: %s already created as %s", metricsInterface.ErrMetricAlreadyRegistered, d.Name, existing.desc.Type)
+		}
+		return existing, nil
+	}
+	m := &Metric{desc: d, rec: b.rec, series: make(map[string]*metricsInterface.Sample)}
+	b.rec.metrics[d.Name] = m
+	return m, nil
+}
+
+func (b *Backend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return b.newMetric(Descriptor{Name: name, Help: help, Type: metricsInterface.CounterType, Labels: labels})
+}
+
+func (b *Backend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return b.newMetric(Descriptor{Name: name, Help: help, Type: metricsInterface.GaugeType, Labels: labels})
+}
+
+func (b *Backend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
+	return b.newMetric(Descriptor{Name: name, Help: help, Type: metricsInterface.HistogramType, Labels: labels, Buckets: buckets})
+}
+
+func (b *Backend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	return b.newMetric(Descriptor{Name: name, Help: help, Type: metricsInterface.SummaryType, Labels: labels,
+		Objectives: objectives, MaxAge: maxAge})
+}
+
+// PushToGateway only counts the push.
+func (b *Backend) PushToGateway(gatewayURL, jobName string) error {
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+	b.rec.pushes++
+	return nil
+}
+
+// Calls returns every operation received so far, in order, including the
+// rejected ones (with Err set).
+func (b *Backend) Calls() []Call {
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+	return slices.Clone(b.rec.calls)
+}
+
+// CallsFor returns the operations received by one metric.
+func (b *Backend) CallsFor(name string) []Call {
+	var calls []Call
+	for _, c := range b.Calls() {
+		if c.Metric == name {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Pushes returns how often PushToGateway was called.
+func (b *Backend) Pushes() int {
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+	return b.rec.pushes
+}
+
+// Descriptor returns how the metric was created.
+func (b *Backend) Descriptor(name string) (Descriptor, bool) {
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+
+	m, ok := b.rec.metrics[name]
+	if !ok {
+		return Descriptor{}, false
+	}
+	return m.desc, true
+}
+
+// Metrics returns the names of the metrics created so far, sorted.
+func (b *Backend) Metrics() []string {
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+	return slices.Sorted(maps.Keys(b.rec.metrics))
+}
+
+// Reset forgets the recorded calls and pushes; metric values are kept.
+func (b *Backend) Reset() {
+	b.rec.mu.Lock()
+	defer b.rec.mu.Unlock()
+	b.rec.calls = nil
+	b.rec.pushes = 0
+}
+
+// Metric is a metric of the in-memory Backend.
+type Metric struct {
+	desc   Descriptor
+	rec    *recorder
+	series map[string]*metricsInterface.Sample
+}
+
+// apply records the call and, if it is valid, applies fn to the series.
+func (m *Metric) apply(op string, value float64, labels map[string]string, allowed bool, fn func(*metricsInterface.Sample)) error {
+	var err error
+	switch {
+	case !allowed:
+		err = metricsInterface.ErrInvalidOperation
+	default:
+		err = metricsInterface.CheckLabels(m.desc.Labels, labels)
+	}
+
+	m.rec.mu.Lock()
+	defer m.rec.mu.Unlock()
+
+	m.rec.calls = append(m.rec.calls, Call{Metric: m.desc.Name, Op: op, Value: value, Labels: copyLabels(labels), Err: err})
+	if err != nil {
+		return err
+	}
+
+	key := metricsInterface.SeriesKey(labels)
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricsInterface.Sample{Labels: copyLabels(labels)}
+		m.series[key] = s
+	}
+	fn(s)
+	return nil
+}
+
+func (m *Metric) isGauge() bool {
+	return m.desc.Type == metricsInterface.GaugeType
+}
+
+func (m *Metric) isObservation() bool {
+	return m.desc.Type == metricsInterface.HistogramType || m.desc.Type == metricsInterface.SummaryType
+}
+
+func (m *Metric) Inc(labels map[string]string) error {
+	return m.apply("Inc", 1, labels, !m.isObservation(), func(s *metricsInterface.Sample) { s.Value++ })
+}
+
+func (m *Metric) Dec(labels map[string]string) error {
+	return m.apply("Dec", 1, labels, m.isGauge(), func(s *metricsInterface.Sample) { s.Value-- })
+}
+
+func (m *Metric) Add(value float64, labels map[string]string) error {
+	allowed := m.isGauge() || m.desc.Type == metricsInterface.CounterType && value >= 0
+	return m.apply("Add", value, labels, allowed, func(s *metricsInterface.Sample) { s.Value += value })
+}
+
+func (m *Metric) Set(value float64, labels map[string]string) error {
+	return m.apply("Set", value, labels, m.isGauge(), func(s *metricsInterface.Sample) { s.Value = value })
+}
+
+func (m *Metric) Observe(value float64, labels map[string]string) error {
+	return m.apply("Observe", value, labels, m.isObservation(), func(s *metricsInterface.Sample) {
+		s.Count++
+		s.Sum += value
+	})
+}
+
+func (m *Metric) GetMetricType() metricsInterface.MetricType {
+	return m.desc.Type
+}
+
+func (m *Metric) DeleteSeries(labels map[string]string) bool {
+	m.rec.mu.Lock()
+	defer m.rec.mu.Unlock()
+
+	key := metricsInterface.SeriesKey(labels)
+	if _, ok := m.series[key]; !ok {
+		return false
+	}
+	delete(m.series, key)
+	return true
+}
+
+func (m *Metric) DeletePartialMatch(labels map[string]string) int {
+	m.rec.mu.Lock()
+	defer m.rec.mu.Unlock()
+
+	deleted := 0
+	for key, s := range m.series {
+		if metricsInterface.MatchesLabels(s.Labels, labels) {
+			delete(m.series, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (m *Metric) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	if err := metricsInterface.CheckLabels(m.desc.Labels, labels); err != nil {
+		return metricsInterface.Sample{}, err
+	}
+
+	m.rec.mu.Lock()
+	defer m.rec.mu.Unlock()
+
+	s, ok := m.series[metricsInterface.SeriesKey(labels)]
+	if !ok {
+		return metricsInterface.Sample{}, metricsInterface.ErrSeriesNotFound
+	}
+	return copySample(s), nil
+}
+
+func (m *Metric) Series() ([]metricsInterface.Sample, error) {
+	m.rec.mu.Lock()
+	defer m.rec.mu.Unlock()
+
+	keys := slices.Collect(maps.Keys(m.series))
+	sort.Strings(keys)
+
+	samples := make([]metricsInterface.Sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, copySample(m.series[key]))
+	}
+	return samples, nil
+}
+
+func copySample(s *metricsInterface.Sample) metricsInterface.Sample {
+	out := *s
+	out.Labels = copyLabels(s.Labels)
+	return out
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
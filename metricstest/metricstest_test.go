@@ -0,0 +1,151 @@
+package metricstest
+
+import (
+	"amantya_metrics/models"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeTB records failures instead of failing the real test, so the failure
+// paths of the helpers can be checked.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	fatal    bool
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...any) {
+	f.Errorf(format, args...)
+	f.fatal = true
+	runtime.Goexit()
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+// run calls fn with a fakeTB on its own goroutine, as Fatalf ends it, and
+// then runs the registered cleanups.
+func run(fn func(tb *fakeTB)) *fakeTB {
+	tb := &fakeTB{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(tb)
+	}()
+	<-done
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+	return tb
+}
+
+var registeredUEs = models.KPI{
+	Name:           "RegisteredUEs",
+	DisplayName:    "Registered UEs",
+	PrometheusType: "Counter",
+	Object:         []string{"NetworkSlice"},
+	Increment:      true,
+}
+
+var activeSessions = models.KPI{
+	Name:           "ActiveSessions",
+	DisplayName:    "Active Sessions",
+	PrometheusType: "Gauge",
+	Object:         []string{"NetworkSlice"},
+	Increment:      true,
+	Decrement:      true,
+}
+
+func TestNewFramework(t *testing.T) {
+	fw, backend := NewFramework(t, registeredUEs, activeSessions)
+
+	if got := fw.ListMetrics(); len(got) != 2 {
+		t.Fatalf("ListMetrics() = %v, want 2 metrics", got)
+	}
+	desc, ok := backend.Descriptor("registered_ues")
+	if !ok {
+		t.Fatalf("registered_ues was not created on the backend")
+	}
+	if desc.Type != "Counter" || len(desc.Labels) != 1 || desc.Labels[0] != "NetworkSlice" {
+		t.Errorf("registered_ues created as %+v", desc)
+	}
+}
+
+func TestNewFrameworkInvalidKPI(t *testing.T) {
+	tb := run(func(tb *fakeTB) {
+		NewFramework(tb, models.KPI{Name: "Broken", DisplayName: "Broken", PrometheusType: "Counter"})
+		t.Error("NewFramework returned for an invalid KPI")
+	})
+
+	if !tb.fatal || len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "must allow increment") {
+		t.Errorf("got fatal=%v errors %q, want a validation failure", tb.fatal, tb.errors)
+	}
+}
+
+func TestAssertCounter(t *testing.T) {
+	fw, _ := NewFramework(t, registeredUEs, activeSessions)
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+	if err := fw.AddToMetric("RegisteredUEs", 3, slice1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.SetMetric("ActiveSessions", 3, slice1); err != nil {
+		t.Fatal(err)
+	}
+
+	AssertCounter(t, fw, "RegisteredUEs", slice1, 3)
+
+	tests := []struct {
+		name   string
+		metric string
+		labels map[string]string
+		want   float64
+		err    string
+	}{
+		{"wrong value", "RegisteredUEs", slice1, 4, "= 3, want 4"},
+		{"missing series", "RegisteredUEs", map[string]string{"NetworkSlice": "slice2"}, 0, "has no series"},
+		{"unknown metric", "Unknown", slice1, 0, "reading Unknown"},
+		{"not a counter", "ActiveSessions", slice1, 3, "is a Gauge, want a Counter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := run(func(tb *fakeTB) { AssertCounter(tb, fw, tt.metric, tt.labels, tt.want) })
+			if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], tt.err) {
+				t.Errorf("got errors %q, want one containing %q", tb.errors, tt.err)
+			}
+		})
+	}
+}
+
+func TestAssertNoSeries(t *testing.T) {
+	fw, _ := NewFramework(t, registeredUEs)
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+
+	AssertNoSeries(t, fw, "RegisteredUEs", nil)
+
+	if err := fw.IncrementMetric("RegisteredUEs", slice1); err != nil {
+		t.Fatal(err)
+	}
+	AssertNoSeries(t, fw, "RegisteredUEs", map[string]string{"NetworkSlice": "slice2"})
+
+	for _, labels := range []map[string]string{nil, slice1} {
+		tb := run(func(tb *fakeTB) { AssertNoSeries(tb, fw, "RegisteredUEs", labels) })
+		if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "want none matching") {
+			t.Errorf("AssertNoSeries(%v) errors %q, want one for the slice1 series", labels, tb.errors)
+		}
+	}
+
+	if err := fw.DeleteSeries("RegisteredUEs", slice1); err != nil {
+		t.Fatal(err)
+	}
+	AssertNoSeries(t, fw, "RegisteredUEs", nil)
+}
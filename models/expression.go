@@ -0,0 +1,300 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed derived-KPI expression. The syntax is arithmetic over
+// numbers and metric references:
+//
+//	100 * sum(reg_success) / sum(reg_attempts)
+//	rate(pdu_session_total{Cause="Success"})
+//
+// A bare reference is the same as sum(). Aggregations are sum, avg, min, max,
+// count and rate (per second, between two evaluations).
+type Expr interface {
+	String() string
+}
+
+// NumberExpr is a numeric literal.
+type NumberExpr struct {
+	Value float64
+}
+
+// RefExpr aggregates the series of a metric that match Matchers.
+type RefExpr struct {
+	Func     string
+	Metric   string
+	Matchers map[string]string
+}
+
+// BinaryExpr applies one of + - * / to two operands.
+type BinaryExpr struct {
+	Op          byte
+	Left, Right Expr
+}
+
+var ExpressionFuncs = []string{"sum", "avg", "min", "max", "count", "rate"}
+
+func (e NumberExpr) String() string {
+	return strconv.FormatFloat(e.Value, 'g', -1, 64)
+}
+
+func (e RefExpr) String() string {
+	var b strings.Builder
+	b.WriteString(e.Func)
+	b.WriteByte('(')
+	b.WriteString(e.Metric)
+	if len(e.Matchers) > 0 {
+		b.WriteByte('{')
+		for i, label := range sortedKeys(e.Matchers) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=%q", label, e.Matchers[label])
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func (e BinaryExpr) String() string {
+	return "(" + e.Left.String() + " " + string(e.Op) + " " + e.Right.String() + ")"
+}
+
+// References returns the metric references of an expression in order of
+// appearance.
+func References(e Expr) []RefExpr {
+	switch e := e.(type) {
+	case RefExpr:
+		return []RefExpr{e}
+	case BinaryExpr:
+		return append(References(e.Left), References(e.Right)...)
+	}
+	return nil
+}
+
+// UsesRate reports whether the expression applies rate() to a reference.
+func UsesRate(e Expr) bool {
+	for _, ref := range References(e) {
+		if ref.Func == "rate" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseExpression parses a derived-KPI expression.
+func ParseExpression(src string) (Expr, error) {
+	p := &exprParser{src: src}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return expr, nil
+}
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of the input.
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.src) {
+			return p.errorf("expected %q, got end of expression", c)
+		}
+		return p.errorf("expected %q, got %q", c, p.src[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseSum() (Expr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseProduct() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return BinaryExpr{Op: '-', Left: NumberExpr{}, Right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		expr, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(')')
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isIdentStart(c):
+		name := p.parseIdent()
+		if p.peek() != '(' {
+			return p.parseRef("sum", name)
+		}
+		if !isExpressionFunc(name) {
+			return nil, p.errorf("unknown function %s, expected one of %s", name, strings.Join(ExpressionFuncs, ", "))
+		}
+		p.pos++
+		if !isIdentStart(p.peek()) {
+			return nil, p.errorf("%s() takes a metric name", name)
+		}
+		ref, err := p.parseRef(name, p.parseIdent())
+		if err != nil {
+			return nil, err
+		}
+		return ref, p.expect(')')
+	case c == 0:
+		return nil, p.errorf("unexpected end of expression")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *exprParser) parseNumber() (Expr, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return NumberExpr{Value: value}, nil
+}
+
+func (p *exprParser) parseIdent() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// parseRef parses the optional {label="value", ...} selector after a metric name.
+func (p *exprParser) parseRef(fn, metric string) (Expr, error) {
+	ref := RefExpr{Func: fn, Metric: metric}
+	if p.peek() != '{' {
+		return ref, nil
+	}
+	p.pos++
+
+	ref.Matchers = make(map[string]string)
+	for p.peek() != '}' {
+		if len(ref.Matchers) > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		if !isIdentStart(p.peek()) {
+			return nil, p.errorf("expected label name")
+		}
+		label := p.parseIdent()
+		if err := p.expect('='); err != nil {
+			return nil, err
+		}
+		if p.peek() != '"' {
+			return nil, p.errorf("expected quoted value for label %s", label)
+		}
+		end := strings.IndexByte(p.src[p.pos+1:], '"')
+		if end < 0 {
+			return nil, p.errorf("unterminated value for label %s", label)
+		}
+		ref.Matchers[label] = p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	}
+	p.pos++
+	return ref, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.' || c == ':'
+}
+
+func isExpressionFunc(name string) bool {
+	for _, fn := range ExpressionFuncs {
+		if fn == name {
+			return true
+		}
+	}
+	return false
+}
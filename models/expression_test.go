@@ -0,0 +1,110 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"42", "42"},
+		{"0.5", "0.5"},
+		{"attempts", "sum(attempts)"},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"8 / 4 / 2", "((8 / 4) / 2)"},
+		{"1 + 2 - 3 * 4 / 5", "((1 + 2) - ((3 * 4) / 5))"},
+		{"-a * b", "((0 - sum(a)) * sum(b))"},
+		{"2 - -3", "(2 - (0 - 3))"},
+		{"100 * sum(reg{Result=\"Success\"}) / sum(reg)",
+			"((100 * sum(reg{Result=\"Success\"})) / sum(reg))"},
+		{"avg(amf.sessions{Slice=\"1\", Cause=\"a b\"})", "avg(amf.sessions{Cause=\"a b\",Slice=\"1\"})"},
+		{"rate( requests )", "rate(requests)"},
+		{"count(x{})", "count(x)"},
+	}
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.src)
+		if err != nil {
+			t.Errorf("ParseExpression(%q): %v", tt.src, err)
+			continue
+		}
+		if got := expr.String(); got != tt.want {
+			t.Errorf("ParseExpression(%q) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", `expected ')', got end of expression`},
+		{"1 + 2)", `unexpected ')'`},
+		{"1 2", `unexpected '2'`},
+		{"1..2", `invalid number "1..2"`},
+		{"median(x)", "unknown function median"},
+		{"sum(1)", "sum() takes a metric name"},
+		{"sum(x", `expected ')', got end of expression`},
+		{"x{Result}", `expected '=', got '}'`},
+		{"x{Result=Success}", "expected quoted value for label Result"},
+		{`x{Result="Success}`, "unterminated value for label Result"},
+		{`x{Result="a" Cause="b"}`, `expected ',', got 'C'`},
+		{"* 2", `unexpected '*'`},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpression(tt.src)
+		if err == nil {
+			t.Errorf("ParseExpression(%q) succeeded, want error %q", tt.src, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseExpression(%q) error %q, want it to contain %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	expr, err := ParseExpression(`rate(a{x="1"}) / (b + max(c))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := References(expr)
+	var got []string
+	for _, ref := range refs {
+		got = append(got, ref.Func+":"+ref.Metric)
+	}
+	if want := "rate:a sum:b max:c"; strings.Join(got, " ") != want {
+		t.Errorf("References() = %v, want %s", got, want)
+	}
+	if !UsesRate(expr) {
+		t.Error("UsesRate() = false, want true")
+	}
+
+	expr, _ = ParseExpression("a / b")
+	if UsesRate(expr) {
+		t.Error("UsesRate(a / b) = true, want false")
+	}
+}
+
+func TestValidateRateNeedsInterval(t *testing.T) {
+	kpis := []KPI{
+		{Name: "Requests", DisplayName: "requests", PrometheusType: "Counter", Increment: true},
+		{Name: "RequestRate", DisplayName: "request_rate", PrometheusType: "Gauge", Expression: "rate(requests)"},
+	}
+	err := ValidateKPIs(kpis, ValidationStrict)
+	if err == nil || !strings.Contains(err.Error(), "eval_interval: required for expressions using rate()") {
+		t.Fatalf("ValidateKPIs() = %v, want an eval_interval issue", err)
+	}
+
+	kpis[1].EvalInterval = "30s"
+	if err := ValidateKPIs(kpis, ValidationStrict); err != nil {
+		t.Errorf("ValidateKPIs() with eval_interval = %v", err)
+	}
+}
@@ -1,41 +1,222 @@
 package models
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"os"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OverflowPolicy decides what happens to an update that would create a new
+// series once a metric has reached its cardinality limit.
+type OverflowPolicy string
+
+const (
+	// OverflowReject fails the update with ErrCardinalityExceeded.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDrop silently discards the update.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowFold records the update on a series whose label values are all "__overflow__".
+	OverflowFold OverflowPolicy = "fold"
+)
+
+// KPI types (the "type" field) with framework semantics. Other values are
+// descriptive and the metric follows prometheus_type.
+const (
+	TypeMean        = "Mean"
+	TypeMax         = "Max"
+	TypeMin         = "Min"
+	TypeCumulative  = "Cumulative"
+	TypeSuccessRate = "SuccessRate"
+)
+
+const (
+	DefaultSampleInterval    = 10 * time.Second
+	DefaultObservationPeriod = 15 * time.Minute
 )
 
 type KPI struct {
-	Name           string   `json:"name"`
-	DisplayName    string   `json:"displayName"`
-	Description    string   `json:"description"`
-	Formula        string   `json:"formula"`
-	Unit           string   `json:"unit"`
-	Type           string   `json:"type"`
-	Object         []string `json:"object"`
-	PrometheusType string   `json:"prometheus_type"`
-	NFType         string   `json:"nf_type"`
-	Increment      bool     `json:"increment"`
-	Decrement      bool     `json:"decrement"`
-}
-
-func LoadKPIsFromFile(filePath string) ([]KPI, error) {
-	file, err := os.Open("/home/amantya/Music/amantya_metrics/models/kpi.json")
+	Name           string                 `json:"name"`
+	DisplayName    string                 `json:"displayName"`
+	Description    string                 `json:"description"`
+	Formula        string                 `json:"formula"`
+	Unit           string                 `json:"unit"`
+	Type           string                 `json:"type"`
+	Object         []string               `json:"object"`
+	PrometheusType string                 `json:"prometheus_type"`
+	NFType         string                 `json:"nf_type"`
+	Increment      bool                   `json:"increment"`
+	Decrement      bool                   `json:"decrement"`
+	Buckets        []float64              `json:"buckets,omitempty"`
+	Objectives     map[string]float64     `json:"objectives,omitempty"`
+	MaxAge         string                 `json:"max_age,omitempty"`
+	ConstLabels    map[string]string      `json:"const_labels,omitempty"`
+	MaxSeries      int                    `json:"max_series,omitempty"`
+	OverflowPolicy OverflowPolicy         `json:"overflow_policy,omitempty"`
+	LabelValues    map[string]LabelValues `json:"label_values,omitempty"`
+	SeriesTTL      string                 `json:"series_ttl,omitempty"`
+	Expression     string                 `json:"expression,omitempty"`
+	EvalInterval   string                 `json:"eval_interval,omitempty"`
+	SampleInterval string                 `json:"sample_interval,omitempty"`
+	Period         string                 `json:"observation_period,omitempty"`
+
+	// Where the KPI was loaded from, for error reporting
+	source string
+	index  int
+}
+
+// Source is the file the KPI was loaded from, or "<input>" when unknown.
+func (k KPI) Source() string {
+	if k.source == "" {
+		return "<input>"
+	}
+	return k.source
+}
+
+// MergeConstLabels returns the constant labels for this KPI: the global set
+// with the KPI's own const_labels added on top, overriding equal keys.
+func (k KPI) MergeConstLabels(global map[string]string) map[string]string {
+	merged := make(map[string]string, len(global)+len(k.ConstLabels))
+	for name, value := range global {
+		merged[name] = value
+	}
+	for name, value := range k.ConstLabels {
+		merged[name] = value
+	}
+	return merged
+}
+
+// SummaryObjectives converts the JSON objectives ({"0.99": 0.001}) into the
+// quantile -> allowed error map expected by the backends.
+func (k KPI) SummaryObjectives() (map[float64]float64, error) {
+	objectives := make(map[float64]float64, len(k.Objectives))
+	for q, e := range k.Objectives {
+		quantile, err := strconv.ParseFloat(q, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantile %q: %w", q, err)
+		}
+		if quantile < 0 || quantile > 1 {
+			return nil, fmt.Errorf("quantile %q out of range [0, 1]", q)
+		}
+		objectives[quantile] = e
+	}
+	return objectives, nil
+}
+
+// SummaryMaxAge parses max_age (e.g. "10m"); zero means the backend default.
+func (k KPI) SummaryMaxAge() (time.Duration, error) {
+	if k.MaxAge == "" {
+		return 0, nil
+	}
+	maxAge, err := time.ParseDuration(k.MaxAge)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("invalid max_age %q: %w", k.MaxAge, err)
 	}
-	defer file.Close()
+	return maxAge, nil
+}
 
-	byteValue, err := ioutil.ReadAll(file)
+// TTL parses series_ttl (e.g. "30m"); zero means series never expire.
+func (k KPI) TTL() (time.Duration, error) {
+	if k.SeriesTTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(k.SeriesTTL)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("invalid series_ttl %q: %w", k.SeriesTTL, err)
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("series_ttl %q must not be negative", k.SeriesTTL)
 	}
+	return ttl, nil
+}
+
+// Derived reports whether the KPI is a gauge computed from the machine-readable
+// expression. Formula remains a human-readable description.
+func (k KPI) Derived() bool {
+	return k.Expression != ""
+}
+
+// EvaluationInterval parses eval_interval; zero means the derived KPI is
+// evaluated whenever it is read.
+func (k KPI) EvaluationInterval() (time.Duration, error) {
+	if k.EvalInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(k.EvalInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid eval_interval %q: %w", k.EvalInterval, err)
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("eval_interval %q must not be negative", k.EvalInterval)
+	}
+	return interval, nil
+}
 
-	var kpis []KPI
-	if err := json.Unmarshal(byteValue, &kpis); err != nil {
-		return nil, err
+// Sampled reports whether the KPI is a sampling gauge: the NF maintains a
+// level and the framework exposes its mean, max and min over the observation
+// period.
+func (k KPI) Sampled() bool {
+	switch k.Type {
+	case TypeMean, TypeMax, TypeMin:
+		return true
 	}
+	return false
+}
 
-	return kpis, nil
+// StatisticNames returns the extra metric names a sampling gauge publishes
+// next to its own: <metric name>_<stat> for the two statistics other than
+// its type, e.g. x_mean and x_min for a Max KPI. It is empty for other KPIs.
+func (k KPI) StatisticNames() map[string]string {
+	if !k.Sampled() {
+		return nil
+	}
+	names := make(map[string]string, 2)
+	for _, stat := range []string{TypeMean, TypeMax, TypeMin} {
+		if stat != k.Type {
+			stat = strings.ToLower(stat)
+			names[stat] = k.MetricName() + "_" + stat
+		}
+	}
+	return names
+}
+
+// UpDown reports whether a plain gauge is moved by increments and decrements,
+// like a count of active sessions, rather than set to a measured level.
+// Backends that distinguish the two export it as an up-down counter.
+func (k KPI) UpDown() bool {
+	return k.MetricType() == "Gauge" && !k.Sampled() && !k.Derived() && (k.Increment || k.Decrement)
+}
+
+// MetricType is the backend metric type of the KPI: Gauge for sampled and
+// SuccessRate KPIs, Counter for Cumulative ones, prometheus_type otherwise.
+func (k KPI) MetricType() string {
+	switch {
+	case k.Sampled(), k.Type == TypeSuccessRate && k.PrometheusType == "":
+		return "Gauge"
+	case k.Type == TypeCumulative && k.PrometheusType == "":
+		return "Counter"
+	}
+	return k.PrometheusType
+}
+
+// Sampling parses sample_interval and observation_period, applying the defaults.
+func (k KPI) Sampling() (interval, period time.Duration, err error) {
+	interval, period = DefaultSampleInterval, DefaultObservationPeriod
+	if k.SampleInterval != "" {
+		if interval, err = time.ParseDuration(k.SampleInterval); err != nil {
+			return 0, 0, fmt.Errorf("invalid sample_interval %q: %w", k.SampleInterval, err)
+		}
+	}
+	if k.Period != "" {
+		if period, err = time.ParseDuration(k.Period); err != nil {
+			return 0, 0, fmt.Errorf("invalid observation_period %q: %w", k.Period, err)
+		}
+	}
+	if interval <= 0 || period <= 0 {
+		return 0, 0, fmt.Errorf("sample_interval and observation_period must be positive")
+	}
+	if interval > period {
+		return 0, 0, fmt.Errorf("sample_interval %s is longer than observation_period %s", interval, period)
+	}
+	return interval, period, nil
 }
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LabelValues declares the values a KPI label may take. A value conforms if
+// it is one of Values or fully matches Pattern.
+type LabelValues struct {
+	Values  []string `json:"values,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	// Normalize retries a non-conforming value trimmed and case-folded, and
+	// records it under the declared spelling when that conforms.
+	Normalize bool `json:"normalize,omitempty"`
+	// Fallback is recorded instead of a value that still does not conform.
+	// Without a fallback such values are rejected.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// LabelRule is the compiled form of LabelValues.
+type LabelRule struct {
+	values    map[string]bool
+	folded    map[string]string
+	pattern   *regexp.Regexp
+	normalize bool
+	fallback  string
+}
+
+func (lv LabelValues) Compile() (*LabelRule, error) {
+	if len(lv.Values) == 0 && lv.Pattern == "" {
+		return nil, fmt.Errorf("declares neither values nor pattern")
+	}
+
+	rule := &LabelRule{
+		values:    make(map[string]bool, len(lv.Values)),
+		folded:    make(map[string]string, len(lv.Values)),
+		normalize: lv.Normalize,
+		fallback:  lv.Fallback,
+	}
+	for _, v := range lv.Values {
+		rule.values[v] = true
+		rule.folded[strings.ToLower(v)] = v
+	}
+	if lv.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + lv.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", lv.Pattern, err)
+		}
+		rule.pattern = pattern
+	}
+	if lv.Fallback != "" && !rule.conforms(lv.Fallback) {
+		return nil, fmt.Errorf("fallback %q does not conform to the declared values", lv.Fallback)
+	}
+	return rule, nil
+}
+
+func (r *LabelRule) conforms(value string) bool {
+	return r.values[value] || (r.pattern != nil && r.pattern.MatchString(value))
+}
+
+// Apply returns the value to record for value, and false if it must be rejected.
+func (r *LabelRule) Apply(value string) (string, bool) {
+	if r.conforms(value) {
+		return value, true
+	}
+
+	if r.normalize {
+		trimmed := strings.TrimSpace(value)
+		if declared, ok := r.folded[strings.ToLower(trimmed)]; ok {
+			return declared, true
+		}
+		if r.pattern != nil {
+			for _, candidate := range []string{trimmed, strings.ToLower(trimmed), strings.ToUpper(trimmed)} {
+				if r.pattern.MatchString(candidate) {
+					return candidate, true
+				}
+			}
+		}
+	}
+
+	if r.fallback != "" {
+		return r.fallback, true
+	}
+	return "", false
+}
+
+// CompileLabelRules compiles the label_values of the KPI, keyed by label name.
+func (k KPI) CompileLabelRules() (map[string]*LabelRule, error) {
+	rules := make(map[string]*LabelRule, len(k.LabelValues))
+	for label, lv := range k.LabelValues {
+		rule, err := lv.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", label, err)
+		}
+		rules[label] = rule
+	}
+	return rules, nil
+}
+
+// DeclaredLabelSets expands the enumerated label values of the KPI into every
+// label combination. It returns false when some object label has no
+// enumerated values, since its series cannot be known in advance.
+func (k KPI) DeclaredLabelSets() ([]map[string]string, bool) {
+	sets := []map[string]string{{}}
+	for _, label := range k.Object {
+		values := k.LabelValues[label].Values
+		if len(values) == 0 {
+			return nil, false
+		}
+
+		next := make([]map[string]string, 0, len(sets)*len(values))
+		for _, set := range sets {
+			for _, value := range values {
+				combined := make(map[string]string, len(set)+1)
+				for k, v := range set {
+					combined[k] = v
+				}
+				combined[label] = value
+				next = append(next, combined)
+			}
+		}
+		sets = next
+	}
+	return sets, true
+}
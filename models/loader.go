@@ -0,0 +1,252 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// FormatForPath picks the catalogue format from the file extension; anything
+// that is not .yaml/.yml is treated as JSON.
+func FormatForPath(p string) Format {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+func isCatalogueFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// LoadKPIsFromFile loads a single catalogue file, a directory of catalogue
+// files, or every file matching a glob pattern.
+func LoadKPIsFromFile(filePath string) ([]KPI, error) {
+	return LoadKPIs(filePath)
+}
+
+// LoadKPIs loads and concatenates the KPIs from every source in order. Each
+// source may be a file, a directory (non-recursive, *.json/*.yaml/*.yml) or
+// a glob pattern.
+func LoadKPIs(sources ...string) ([]KPI, error) {
+	var kpis []KPI
+	for _, source := range sources {
+		files, err := expandPath(source)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			loaded, err := loadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			kpis = append(kpis, loaded...)
+		}
+	}
+	return kpis, nil
+}
+
+func expandPath(source string) ([]string, error) {
+	if hasGlobMeta(source) {
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KPI pattern %q: %w", source, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no KPI files match %q", source)
+		}
+		sort.Strings(matches)
+		return matches, nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isCatalogueFile(entry.Name()) {
+			files = append(files, filepath.Join(source, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no KPI files found in directory %q", source)
+	}
+	return files, nil
+}
+
+func loadFile(filePath string) ([]KPI, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	kpis, err := LoadKPIsFromReader(file, FormatForPath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return withSource(kpis, filePath), nil
+}
+
+// LoadKPIsFromFS loads catalogues from fsys, typically an embed.FS compiled
+// into the binary. Sources follow the same file/directory/glob rules as
+// LoadKPIs, using slash-separated fs paths.
+func LoadKPIsFromFS(fsys fs.FS, sources ...string) ([]KPI, error) {
+	var kpis []KPI
+	for _, source := range sources {
+		files, err := expandFSPath(fsys, source)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			loaded, err := decodeKPIs(data, FormatForPath(file))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			kpis = append(kpis, withSource(loaded, file)...)
+		}
+	}
+	return kpis, nil
+}
+
+func withSource(kpis []KPI, source string) []KPI {
+	for i := range kpis {
+		kpis[i].source = source
+		kpis[i].index = i
+	}
+	return kpis
+}
+
+func expandFSPath(fsys fs.FS, source string) ([]string, error) {
+	if hasGlobMeta(source) {
+		matches, err := fs.Glob(fsys, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KPI pattern %q: %w", source, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no KPI files match %q", source)
+		}
+		return matches, nil
+	}
+
+	info, err := fs.Stat(fsys, source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	entries, err := fs.ReadDir(fsys, source)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isCatalogueFile(entry.Name()) {
+			files = append(files, path.Join(source, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no KPI files found in directory %q", source)
+	}
+	return files, nil
+}
+
+// LoadKPIsFromReader decodes a single catalogue (a list of KPIs) from r.
+func LoadKPIsFromReader(r io.Reader, format Format) ([]KPI, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKPIs(data, format)
+}
+
+func decodeKPIs(data []byte, format Format) ([]KPI, error) {
+	switch format {
+	case FormatJSON:
+	case FormatYAML:
+		// Round-trip through JSON so the json tags on KPI are the single
+		// source of truth for field names in both formats.
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		converted, err := json.Marshal(stringKeys(doc))
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	default:
+		return nil, fmt.Errorf("unsupported KPI format %q", format)
+	}
+
+	var kpis []KPI
+	if err := json.Unmarshal(data, &kpis); err != nil {
+		return nil, err
+	}
+	return kpis, nil
+}
+
+// stringKeys rewrites YAML maps with non-string keys (e.g. unquoted quantiles
+// in objectives) into string-keyed maps that encoding/json can marshal.
+func stringKeys(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return out
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = stringKeys(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = stringKeys(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
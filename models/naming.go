@@ -0,0 +1,95 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeMetricName turns a KPI display name (or any user supplied metric
+// reference) into a Prometheus-compliant metric name:
+//
+//	"Registration Success Rate (%)"  -> "registration_success_rate_percent"
+//	"Sessions/sec"                   -> "sessions_per_sec"
+//	"5G Reg.Attempts"                -> "g5g_reg_attempts"
+//
+// Letters are lower-cased, "%" becomes "percent", "/" becomes "per", common
+// accented Latin letters are folded to ASCII, every other character outside
+// [a-z0-9_] (dots, dashes, brackets, other non-ASCII runes) becomes "_",
+// runs of "_" are collapsed and trimmed, and a leading digit is prefixed
+// with "g".
+func NormalizeMetricName(displayName string) string {
+	var b strings.Builder
+	b.Grow(len(displayName))
+
+	for _, r := range displayName {
+		r = unicode.ToLower(r)
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '%':
+			b.WriteString("_percent_")
+		case r == '/':
+			b.WriteString("_per_")
+		case latinFold[r] != "":
+			b.WriteString(latinFold[r])
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	name := collapseUnderscores(b.String())
+	if len(name) > 0 && (name[0] >= '0' && name[0] <= '9') {
+		name = "g" + name
+	}
+	return name
+}
+
+var latinFold = func() map[rune]string {
+	groups := map[string]string{
+		"àáâãäå": "a", "ç": "c", "èéêë": "e", "ìíîï": "i", "ñ": "n",
+		"òóôõöø": "o", "ùúûü": "u", "ýÿ": "y", "ß": "ss", "æ": "ae", "œ": "oe",
+	}
+	fold := make(map[rune]string)
+	for runes, ascii := range groups {
+		for _, r := range runes {
+			fold[r] = ascii
+		}
+	}
+	return fold
+}()
+
+func collapseUnderscores(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	prev := byte('_')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' && prev == '_' {
+			continue
+		}
+		b.WriteByte(s[i])
+		prev = s[i]
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// LegacyMetricName is the name releases before NormalizeMetricName gave a
+// display name: lower-cased, spaces and dashes turned into "_", brackets
+// dropped and nothing else changed. It is kept as an alias so references to
+// the old names still resolve.
+func LegacyMetricName(displayName string) string {
+	name := strings.ToLower(displayName)
+	name = strings.ReplaceAll(name, " ", "_")
+	name = strings.ReplaceAll(name, "-", "_")
+	name = strings.ReplaceAll(name, "(", "")
+	name = strings.ReplaceAll(name, ")", "")
+	if len(name) > 0 && (name[0] >= '0' && name[0] <= '9') {
+		name = "g" + name
+	}
+	return name
+}
+
+// MetricName is the normalized metric name of the KPI.
+func (k KPI) MetricName() string {
+	return NormalizeMetricName(k.DisplayName)
+}
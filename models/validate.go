@@ -0,0 +1,292 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type ValidationMode string
+
+const (
+	// ValidationStrict rejects a catalogue with any issue.
+	ValidationStrict ValidationMode = "strict"
+	// ValidationLenient logs every issue as a warning and accepts the catalogue.
+	ValidationLenient ValidationMode = "lenient"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// SupportedPrometheusTypes lists the accepted values of prometheus_type.
+var SupportedPrometheusTypes = []string{"Counter", "Gauge", "Histogram", "Summary"}
+
+// ValidationIssue is a single problem found in a KPI definition.
+type ValidationIssue struct {
+	Source  string
+	Index   int
+	Name    string
+	Field   string
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	loc := fmt.Sprintf("%s[%d]", i.Source, i.Index)
+	if i.Name != "" {
+		loc += fmt.Sprintf(" (%s)", i.Name)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, i.Field, i.Message)
+}
+
+// ValidationError aggregates every issue found in a catalogue.
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, fmt.Sprintf("%d KPI validation issue(s)", len(e.Issues)))
+	for _, issue := range e.Issues {
+		lines = append(lines, "  "+issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateKPIs checks the whole catalogue and reports every problem at once.
+// In ValidationLenient mode the issues are logged and nil is returned.
+func ValidateKPIs(kpis []KPI, mode ValidationMode) error {
+	var issues []ValidationIssue
+	names := make(map[string]int)
+	metricNames := make(map[string]int)
+
+	// Every spelling a derived KPI may use to reference another KPI
+	known := make(map[string]int)
+	// The <name>_<stat> gauges of sampling KPIs
+	statNames := make(map[string]int)
+	for i, kpi := range kpis {
+		for _, ref := range []string{kpi.Name, kpi.DisplayName, kpi.MetricName(), NormalizeMetricName(kpi.Name)} {
+			if _, ok := known[ref]; ref != "" && !ok {
+				known[ref] = i
+			}
+		}
+		for _, name := range kpi.StatisticNames() {
+			if _, ok := statNames[name]; !ok {
+				statNames[name] = i
+			}
+		}
+	}
+
+	for i, kpi := range kpis {
+		report := func(field, format string, args ...interface{}) {
+			issues = append(issues, ValidationIssue{
+				Source:  kpi.Source(),
+				Index:   indexOf(kpi, i),
+				Name:    kpi.Name,
+				Field:   field,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if kpi.Name == "" {
+			report("name", "must not be empty")
+		} else if prev, ok := names[kpi.Name]; ok {
+			report("name", "duplicate of %s", location(kpis[prev], prev))
+		} else {
+			names[kpi.Name] = i
+		}
+
+		if strings.TrimSpace(kpi.DisplayName) == "" {
+			report("displayName", "must not be empty")
+		} else {
+			metricName := kpi.MetricName()
+			if !metricNameRE.MatchString(metricName) {
+				report("displayName", "normalizes to %q, which is not a valid Prometheus metric name", metricName)
+			} else if prev, ok := metricNames[metricName]; ok {
+				report("displayName", "normalized name %q collides with %s", metricName, location(kpis[prev], prev))
+			} else if owner, ok := statNames[metricName]; ok && owner != i {
+				report("displayName", "normalized name %q is used by the sampled statistics of %s", metricName, location(kpis[owner], owner))
+			} else {
+				metricNames[metricName] = i
+			}
+		}
+
+		seen := make(map[string]bool, len(kpi.Object))
+		for _, label := range kpi.Object {
+			switch {
+			case !labelNameRE.MatchString(label):
+				report("object", "%q is not a valid Prometheus label name", label)
+			case strings.HasPrefix(label, "__"):
+				report("object", "%q uses the reserved \"__\" prefix", label)
+			case seen[label]:
+				report("object", "label %q listed more than once", label)
+			}
+			seen[label] = true
+		}
+
+		for _, label := range sortedKeys(kpi.ConstLabels) {
+			switch {
+			case !labelNameRE.MatchString(label):
+				report("const_labels", "%q is not a valid Prometheus label name", label)
+			case strings.HasPrefix(label, "__"):
+				report("const_labels", "%q uses the reserved \"__\" prefix", label)
+			case seen[label]:
+				report("const_labels", "%q is also listed in object", label)
+			}
+		}
+
+		for _, label := range sortedKeys(kpi.LabelValues) {
+			if !seen[label] {
+				report("label_values", "%q is not listed in object", label)
+				continue
+			}
+			if _, err := kpi.LabelValues[label].Compile(); err != nil {
+				report("label_values", "label %s: %v", label, err)
+			}
+		}
+
+		if _, err := kpi.TTL(); err != nil {
+			report("series_ttl", "%v", err)
+		}
+
+		if kpi.Derived() {
+			if expr, err := ParseExpression(kpi.Expression); err != nil {
+				report("expression", "%v", err)
+			} else {
+				// rate() divides by the time since the last evaluation, which
+				// only a fixed interval keeps meaningful
+				if interval, err := kpi.EvaluationInterval(); err == nil && interval == 0 && UsesRate(expr) {
+					report("eval_interval", "required for expressions using rate()")
+				}
+				for _, ref := range References(expr) {
+					target, ok := known[ref.Metric]
+					if !ok {
+						target, ok = known[NormalizeMetricName(ref.Metric)]
+					}
+					switch {
+					case !ok:
+						report("expression", "references unknown metric %q", ref.Metric)
+					case target == i:
+						report("expression", "references itself")
+					}
+				}
+			}
+			if kpi.MetricType() != "Gauge" || kpi.Sampled() {
+				report("expression", "derived KPIs must be plain Gauges")
+			}
+		} else if kpi.EvalInterval != "" {
+			report("eval_interval", "only valid for KPIs with an expression")
+		}
+		if _, err := kpi.EvaluationInterval(); err != nil {
+			report("eval_interval", "%v", err)
+		}
+
+		if kpi.MaxSeries < 0 {
+			report("max_series", "must not be negative")
+		}
+		switch kpi.OverflowPolicy {
+		case "", OverflowReject, OverflowDrop, OverflowFold:
+		default:
+			report("overflow_policy", "unknown policy %q, expected reject, drop or fold", kpi.OverflowPolicy)
+		}
+
+		switch kpi.MetricType() {
+		case "Counter":
+			if !kpi.Increment {
+				report("increment", "a Counter must allow increment")
+			}
+			if kpi.Decrement {
+				report("decrement", "a Counter cannot be decremented")
+			}
+		case "Gauge":
+		case "Histogram":
+			for j := 1; j < len(kpi.Buckets); j++ {
+				if kpi.Buckets[j] <= kpi.Buckets[j-1] {
+					report("buckets", "bucket bounds must be strictly increasing")
+					break
+				}
+			}
+		case "Summary":
+			if _, err := kpi.SummaryObjectives(); err != nil {
+				report("objectives", "%v", err)
+			}
+			if _, err := kpi.SummaryMaxAge(); err != nil {
+				report("max_age", "%v", err)
+			}
+		case "":
+			report("prometheus_type", "must not be empty")
+		default:
+			report("prometheus_type", "unknown type %q, expected one of %s",
+				kpi.PrometheusType, strings.Join(SupportedPrometheusTypes, ", "))
+		}
+
+		switch {
+		case kpi.Sampled():
+			if kpi.PrometheusType == "Histogram" || kpi.PrometheusType == "Summary" {
+				report("type", "%s KPIs are sampled gauges, not a %s", kpi.Type, kpi.PrometheusType)
+			}
+			if _, _, err := kpi.Sampling(); err != nil {
+				report("sample_interval", "%v", err)
+			}
+		case kpi.SampleInterval != "" || kpi.Period != "":
+			report("sample_interval", "only valid for Mean, Max and Min KPIs")
+		}
+		if kpi.Type == TypeCumulative && kpi.MetricType() != "Counter" {
+			report("type", "Cumulative KPIs must be Counters")
+		}
+		if kpi.Type == TypeSuccessRate && kpi.MetricType() != "Gauge" {
+			report("type", "SuccessRate KPIs must be Gauges")
+		}
+
+		if kpi.MetricType() != "Histogram" && len(kpi.Buckets) > 0 {
+			report("buckets", "only valid for Histogram KPIs")
+		}
+		if kpi.MetricType() != "Summary" && (len(kpi.Objectives) > 0 || kpi.MaxAge != "") {
+			report("objectives", "only valid for Summary KPIs")
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(issues, func(a, b int) bool {
+		if issues[a].Source != issues[b].Source {
+			return issues[a].Source < issues[b].Source
+		}
+		return issues[a].Index < issues[b].Index
+	})
+
+	if mode == ValidationLenient {
+		for _, issue := range issues {
+			log.Printf("KPI warning: %s", issue)
+		}
+		return nil
+	}
+	return &ValidationError{Issues: issues}
+}
+
+// indexOf is the position within the source file, falling back to the
+// catalogue position for KPIs that were not loaded from a file.
+func indexOf(kpi KPI, i int) int {
+	if kpi.source == "" {
+		return i
+	}
+	return kpi.index
+}
+
+func location(kpi KPI, i int) string {
+	return fmt.Sprintf("%s[%d]", kpi.Source(), indexOf(kpi, i))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
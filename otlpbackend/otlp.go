@@ -0,0 +1,455 @@
+package otlpbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// OTLPCounter is exported as an observable monotonic counter reporting the
+// running total of every series.
+type OTLPCounter struct {
+	state *seriesState
+}
+
+func (oc *OTLPCounter) Inc(labels map[string]string) error {
+	return oc.Add(1, labels)
+}
+
+func (oc *OTLPCounter) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oc *OTLPCounter) Add(value float64, labels map[string]string) error {
+	if value < 0 {
+		return fmt.Errorf("%w: counter cannot decrease", metricsInterface.ErrInvalidOperation)
+	}
+	oc.state.update(labels, func(v float64) float64 { return v + value })
+	return nil
+}
+
+func (oc *OTLPCounter) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oc *OTLPCounter) Observe(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oc *OTLPCounter) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.CounterType
+}
+
+func (oc *OTLPCounter) DeleteSeries(labels map[string]string) bool {
+	return oc.state.delete(labels)
+}
+
+func (oc *OTLPCounter) DeletePartialMatch(labels map[string]string) int {
+	return oc.state.deletePartialMatch(labels)
+}
+
+func (oc *OTLPCounter) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return oc.state.value(labels)
+}
+
+func (oc *OTLPCounter) Series() ([]metricsInterface.Sample, error) {
+	return oc.state.series(), nil
+}
+
+// OTLPGauge is exported as an observable gauge, or as an observable up-down
+// counter when created by NewUpDownCounter. Either way the absolute value is
+// reported, so Set works on both.
+type OTLPGauge struct {
+	state *seriesState
+}
+
+func (og *OTLPGauge) Inc(labels map[string]string) error {
+	return og.Add(1, labels)
+}
+
+func (og *OTLPGauge) Dec(labels map[string]string) error {
+	return og.Add(-1, labels)
+}
+
+func (og *OTLPGauge) Add(value float64, labels map[string]string) error {
+	og.state.update(labels, func(v float64) float64 { return v + value })
+	return nil
+}
+
+func (og *OTLPGauge) Set(value float64, labels map[string]string) error {
+	og.state.update(labels, func(float64) float64 { return value })
+	return nil
+}
+
+func (og *OTLPGauge) Observe(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (og *OTLPGauge) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.GaugeType
+}
+
+func (og *OTLPGauge) DeleteSeries(labels map[string]string) bool {
+	return og.state.delete(labels)
+}
+
+func (og *OTLPGauge) DeletePartialMatch(labels map[string]string) int {
+	return og.state.deletePartialMatch(labels)
+}
+
+func (og *OTLPGauge) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return og.state.value(labels)
+}
+
+func (og *OTLPGauge) Series() ([]metricsInterface.Sample, error) {
+	return og.state.series(), nil
+}
+
+// OTLPHistogram records observations on an explicit-bucket histogram.
+// Summaries map onto it as well, since OpenTelemetry has no summary
+// instrument. Deleting a series only affects read-back: the SDK keeps
+// exporting the last cumulative histogram of that series until restart.
+type OTLPHistogram struct {
+	histogram  metric.Float64Histogram
+	attrs      []attribute.KeyValue
+	state      *seriesState
+	metricType metricsInterface.MetricType
+}
+
+func (oh *OTLPHistogram) Inc(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oh *OTLPHistogram) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oh *OTLPHistogram) Add(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oh *OTLPHistogram) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (oh *OTLPHistogram) Observe(value float64, labels map[string]string) error {
+	oh.state.observe(labels, value)
+	oh.histogram.Record(context.Background(), value, metric.WithAttributes(attributes(oh.attrs, labels)...))
+	return nil
+}
+
+func (oh *OTLPHistogram) GetMetricType() metricsInterface.MetricType {
+	return oh.metricType
+}
+
+func (oh *OTLPHistogram) DeleteSeries(labels map[string]string) bool {
+	return oh.state.delete(labels)
+}
+
+func (oh *OTLPHistogram) DeletePartialMatch(labels map[string]string) int {
+	return oh.state.deletePartialMatch(labels)
+}
+
+func (oh *OTLPHistogram) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return oh.state.value(labels)
+}
+
+func (oh *OTLPHistogram) Series() ([]metricsInterface.Sample, error) {
+	return oh.state.series(), nil
+}
+
+// attributes combines a metric's constant attributes with the per-call labels.
+func attributes(constAttrs []attribute.KeyValue, labels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(constAttrs)+len(labels))
+	attrs = append(attrs, constAttrs...)
+	for k, v := range labels {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	return attrs
+}
+
+func convertLabelsToAttributes(labels map[string]string) []attribute.KeyValue {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, attribute.String(k, labels[k]))
+	}
+	return attrs
+}
+
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+
+	DefaultNamespace = "amantya"
+	DefaultInterval  = time.Minute
+	DefaultTimeout   = 10 * time.Second
+
+	scopeName = "amantya_metrics"
+)
+
+// Config describes how the backend reaches the OTLP receiver, usually an
+// OpenTelemetry Collector. Endpoint is host:port or a full URL; when empty
+// the exporter's defaults and OTEL_EXPORTER_OTLP_* variables apply.
+// Namespace becomes the service.name resource attribute.
+type Config struct {
+	Endpoint  string
+	Protocol  string
+	Insecure  bool
+	Headers   map[string]string
+	Interval  time.Duration
+	Timeout   time.Duration
+	Namespace string
+}
+
+type OTLPBackend struct {
+	provider    *sdkmetric.MeterProvider
+	meter       metric.Meter
+	timeout     time.Duration
+	constAttrs  []attribute.KeyValue
+	unit        string
+	mu          *sync.Mutex
+	instruments map[string]metricsInterface.Metric
+}
+
+func NewOTLPBackend(cfg Config) (*OTLPBackend, error) {
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(namespace)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OTLP resource: %w", err)
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter,
+			sdkmetric.WithInterval(interval), sdkmetric.WithTimeout(timeout))),
+	)
+
+	return &OTLPBackend{
+		provider:    provider,
+		meter:       provider.Meter(scopeName),
+		timeout:     timeout,
+		mu:          &sync.Mutex{},
+		instruments: make(map[string]metricsInterface.Metric),
+	}, nil
+}
+
+func newExporter(cfg Config) (sdkmetric.Exporter, error) {
+	endpointIsURL := strings.Contains(cfg.Endpoint, "://")
+
+	switch strings.ToLower(cfg.Protocol) {
+	case "", ProtocolGRPC:
+		var opts []otlpmetricgrpc.Option
+		switch {
+		case endpointIsURL:
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(cfg.Headers))
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, otlpmetricgrpc.WithTimeout(cfg.Timeout))
+		}
+		return otlpmetricgrpc.New(context.Background(), opts...)
+	case ProtocolHTTP:
+		var opts []otlpmetrichttp.Option
+		switch {
+		case endpointIsURL:
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, otlpmetrichttp.WithTimeout(cfg.Timeout))
+		}
+		return otlpmetrichttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+	}
+}
+
+// WithConstLabels returns a view of the backend whose metrics carry labels as
+// attributes on every data point.
+func (ob *OTLPBackend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	view := *ob
+	view.constAttrs = convertLabelsToAttributes(labels)
+	return &view
+}
+
+// WithUnit returns a view of the backend whose instruments carry the unit.
+func (ob *OTLPBackend) WithUnit(unit string) metricsInterface.Backend {
+	view := *ob
+	view.unit = unit
+	return &view
+}
+
+// instrument returns the metric already created under name, or registers the
+// one built by create. As with the Prometheus registry, creating a metric
+// twice yields the original, so a reloaded catalogue keeps its series.
+func (ob *OTLPBackend) instrument(name string, create func() (metricsInterface.Metric, error)) (metricsInterface.Metric, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if existing, ok := ob.instruments[name]; ok {
+		return existing, nil
+	}
+	m, err := create()
+	if err != nil {
+		return nil, err
+	}
+	ob.instruments[name] = m
+	return m, nil
+}
+
+// observeState returns the collection callback reporting every series of s.
+func (ob *OTLPBackend) observeState(s *seriesState) metric.Float64Callback {
+	constAttrs := ob.constAttrs
+	return func(_ context.Context, o metric.Float64Observer) error {
+		s.each(func(labels map[string]string, value float64) {
+			o.Observe(value, metric.WithAttributes(attributes(constAttrs, labels)...))
+		})
+		return nil
+	}
+}
+
+func (ob *OTLPBackend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return ob.instrument(name, func() (metricsInterface.Metric, error) {
+		state := newSeriesState()
+		_, err := ob.meter.Float64ObservableCounter(name,
+			metric.WithDescription(help),
+			metric.WithUnit(ob.unit),
+			metric.WithFloat64Callback(ob.observeState(state)))
+		if err != nil {
+			return nil, err
+		}
+		return &OTLPCounter{state: state}, nil
+	})
+}
+
+func (ob *OTLPBackend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return ob.instrument(name, func() (metricsInterface.Metric, error) {
+		state := newSeriesState()
+		_, err := ob.meter.Float64ObservableGauge(name,
+			metric.WithDescription(help),
+			metric.WithUnit(ob.unit),
+			metric.WithFloat64Callback(ob.observeState(state)))
+		if err != nil {
+			return nil, err
+		}
+		return &OTLPGauge{state: state}, nil
+	})
+}
+
+// NewUpDownCounter creates a gauge exported as an additive up-down counter,
+// for values such as active sessions that are summed across series.
+func (ob *OTLPBackend) NewUpDownCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return ob.instrument(name, func() (metricsInterface.Metric, error) {
+		state := newSeriesState()
+		_, err := ob.meter.Float64ObservableUpDownCounter(name,
+			metric.WithDescription(help),
+			metric.WithUnit(ob.unit),
+			metric.WithFloat64Callback(ob.observeState(state)))
+		if err != nil {
+			return nil, err
+		}
+		return &OTLPGauge{state: state}, nil
+	})
+}
+
+func (ob *OTLPBackend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
+	return ob.newHistogram(name, help, buckets, metricsInterface.HistogramType)
+}
+
+func (ob *OTLPBackend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	// OpenTelemetry has no summary instrument; quantiles are computed by the
+	// receiver from the default histogram buckets
+	return ob.newHistogram(name, help, nil, metricsInterface.SummaryType)
+}
+
+func (ob *OTLPBackend) newHistogram(name, help string, buckets []float64, metricType metricsInterface.MetricType) (metricsInterface.Metric, error) {
+	return ob.instrument(name, func() (metricsInterface.Metric, error) {
+		opts := []metric.Float64HistogramOption{
+			metric.WithDescription(help),
+			metric.WithUnit(ob.unit),
+		}
+		if len(buckets) > 0 {
+			opts = append(opts, metric.WithExplicitBucketBoundaries(buckets...))
+		}
+		histogram, err := ob.meter.Float64Histogram(name, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &OTLPHistogram{
+			histogram:  histogram,
+			attrs:      ob.constAttrs,
+			state:      newObservationState(),
+			metricType: metricType,
+		}, nil
+	})
+}
+
+// PushToGateway exports everything collected so far instead of waiting for
+// the next interval; the gateway URL and job name are not used.
+func (ob *OTLPBackend) PushToGateway(gatewayURL, jobName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ob.timeout)
+	defer cancel()
+
+	if err := ob.provider.ForceFlush(ctx); err != nil {
+		return fmt.Errorf("failed to flush OTLP metrics: %w", err)
+	}
+	return nil
+}
+
+// Close exports the final collection and shuts the exporter down.
+func (ob *OTLPBackend) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ob.timeout)
+	defer cancel()
+
+	return ob.provider.Shutdown(ctx)
+}
@@ -0,0 +1,222 @@
+package otlpbackend
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver is an OTLP/HTTP endpoint keeping the metrics of the last export.
+type receiver struct {
+	mu       sync.Mutex
+	exports  int
+	resource []*commonpb.KeyValue
+	metrics  map[string]*metricpb.Metric
+}
+
+func newReceiver(t *testing.T) (*receiver, *httptest.Server) {
+	t.Helper()
+
+	r := &receiver{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/metrics" {
+			http.NotFound(w, req)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var export colmetricpb.ExportMetricsServiceRequest
+		if err := proto.Unmarshal(body, &export); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.mu.Lock()
+		r.exports++
+		r.metrics = make(map[string]*metricpb.Metric)
+		for _, rm := range export.ResourceMetrics {
+			r.resource = rm.Resource.GetAttributes()
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					r.metrics[m.Name] = m
+				}
+			}
+		}
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{})
+		w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *receiver) metric(t *testing.T, name string) *metricpb.Metric {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.metrics[name]
+	if !ok {
+		t.Fatalf("%s was not exported; got %d exports", name, r.exports)
+	}
+	return m
+}
+
+func newTestBackend(t *testing.T, endpoint string) *OTLPBackend {
+	t.Helper()
+
+	ob, err := NewOTLPBackend(Config{Endpoint: endpoint, Protocol: ProtocolHTTP, Namespace: "amf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ob.Close() })
+	return ob
+}
+
+func attrs(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.GetStringValue()
+	}
+	return m
+}
+
+func TestInstrumentMapping(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	ob := newTestBackend(t, srv.URL)
+	nf := ob.WithConstLabels(map[string]string{"nf_type": "AMF"}).(*OTLPBackend)
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+
+	counter, err := nf.WithUnit("{registration}").NewCounter("registrations", "Registration attempts", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gauge, err := nf.NewGauge("cpu_load", "CPU load", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upDown, err := nf.NewUpDownCounter("active_sessions", "Active sessions", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	histogram, err := nf.WithUnit("s").NewHistogram("setup_time", "Setup time", []string{"NetworkSlice"}, []float64{0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter.Add(3, slice1)
+	gauge.Set(0.25, slice1)
+	upDown.Inc(slice1)
+	upDown.Inc(slice1)
+	upDown.Dec(slice1)
+	for _, v := range []float64{0.05, 0.5, 2} {
+		histogram.Observe(v, slice1)
+	}
+
+	if err := ob.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := attrs(rcv.resource)["service.name"]; got != "amf" {
+		t.Errorf("service.name = %q, want amf", got)
+	}
+
+	m := rcv.metric(t, "registrations")
+	if m.Unit != "{registration}" || m.Description != "Registration attempts" {
+		t.Errorf("registrations unit %q, description %q", m.Unit, m.Description)
+	}
+	sum := m.GetSum()
+	if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Fatalf("registrations exported as %v, want a cumulative monotonic sum", m.Data)
+	}
+	if dp := sum.DataPoints[0]; dp.GetAsDouble() != 3 {
+		t.Errorf("registrations = %v, want 3", dp.GetAsDouble())
+	}
+	want := map[string]string{"nf_type": "AMF", "NetworkSlice": "slice1"}
+	if got := attrs(sum.DataPoints[0].Attributes); !maps.Equal(got, want) {
+		t.Errorf("registrations attributes %v, want %v", got, want)
+	}
+
+	m = rcv.metric(t, "cpu_load")
+	if g := m.GetGauge(); g == nil || g.DataPoints[0].GetAsDouble() != 0.25 {
+		t.Errorf("cpu_load exported as %v, want a gauge of 0.25", m.Data)
+	}
+	if m.Unit != "" {
+		t.Errorf("cpu_load unit %q, want none", m.Unit)
+	}
+
+	m = rcv.metric(t, "active_sessions")
+	if s := m.GetSum(); s == nil || s.IsMonotonic || s.DataPoints[0].GetAsDouble() != 1 {
+		t.Errorf("active_sessions exported as %v, want a non-monotonic sum of 1", m.Data)
+	}
+
+	m = rcv.metric(t, "setup_time")
+	h := m.GetHistogram()
+	if h == nil {
+		t.Fatalf("setup_time exported as %v, want a histogram", m.Data)
+	}
+	dp := h.DataPoints[0]
+	if dp.Count != 3 || dp.GetSum() != 2.55 || m.Unit != "s" {
+		t.Errorf("setup_time count %d, sum %v, unit %q", dp.Count, dp.GetSum(), m.Unit)
+	}
+	if !slices.Equal(dp.ExplicitBounds, []float64{0.1, 1}) || !slices.Equal(dp.BucketCounts, []uint64{1, 1, 1}) {
+		t.Errorf("setup_time bounds %v, counts %v", dp.ExplicitBounds, dp.BucketCounts)
+	}
+}
+
+func TestDeletedSeriesNotExported(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	ob := newTestBackend(t, srv.URL)
+	slice1 := map[string]string{"NetworkSlice": "slice1"}
+	slice2 := map[string]string{"NetworkSlice": "slice2"}
+
+	gauge, err := ob.NewGauge("cpu_load", "CPU load", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gauge.Set(1, slice1)
+	gauge.Set(2, slice2)
+	if !gauge.DeleteSeries(slice1) {
+		t.Fatal("DeleteSeries() = false for an existing series")
+	}
+	if err := ob.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	points := rcv.metric(t, "cpu_load").GetGauge().DataPoints
+	if len(points) != 1 || attrs(points[0].Attributes)["NetworkSlice"] != "slice2" {
+		t.Errorf("exported %v, want only the slice2 series", points)
+	}
+}
+
+func TestInstrumentCreatedOnce(t *testing.T) {
+	_, srv := newReceiver(t)
+	ob := newTestBackend(t, srv.URL)
+
+	first, err := ob.NewCounter("registrations", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Inc(nil)
+	second, err := ob.NewCounter("registrations", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample, err := second.Value(nil); err != nil || sample.Value != 1 {
+		t.Errorf("Value() after re-creating = %+v, %v, want the original series", sample, err)
+	}
+}
@@ -0,0 +1,144 @@
+package otlpbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"sort"
+	"sync"
+)
+
+// seriesState keeps the current value of every label set. Counters and
+// gauges are exported through observable instruments, so the collection
+// callbacks report whatever is held here; for histograms values holds the
+// sum of observations and counts their number, for read-back only.
+type seriesState struct {
+	mu     sync.Mutex
+	values map[string]float64
+	counts map[string]uint64
+	labels map[string]map[string]string
+}
+
+func newSeriesState() *seriesState {
+	return &seriesState{
+		values: make(map[string]float64),
+		labels: make(map[string]map[string]string),
+	}
+}
+
+func newObservationState() *seriesState {
+	s := newSeriesState()
+	s.counts = make(map[string]uint64)
+	return s
+}
+
+// update applies fn to the current value of the series and returns the new
+// value.
+func (s *seriesState) update(labels map[string]string, fn func(float64) float64) float64 {
+	key := metricsInterface.SeriesKey(labels)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := fn(s.values[key])
+	s.values[key] = updated
+	if _, ok := s.labels[key]; !ok {
+		s.labels[key] = copyLabels(labels)
+	}
+	return updated
+}
+
+func (s *seriesState) observe(labels map[string]string, value float64) {
+	s.update(labels, func(sum float64) float64 { return sum + value })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[metricsInterface.SeriesKey(labels)]++
+}
+
+// each calls fn for every series while holding the lock; fn must not call
+// back into the state.
+func (s *seriesState) each(fn func(labels map[string]string, value float64)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, labels := range s.labels {
+		fn(labels, s.values[key])
+	}
+}
+
+func (s *seriesState) sample(key string) metricsInterface.Sample {
+	sample := metricsInterface.Sample{Labels: copyLabels(s.labels[key])}
+	if s.counts != nil {
+		sample.Count, sample.Sum = s.counts[key], s.values[key]
+	} else {
+		sample.Value = s.values[key]
+	}
+	return sample
+}
+
+func (s *seriesState) value(labels map[string]string) (metricsInterface.Sample, error) {
+	key := metricsInterface.SeriesKey(labels)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.labels[key]; !ok {
+		return metricsInterface.Sample{}, metricsInterface.ErrSeriesNotFound
+	}
+	return s.sample(key), nil
+}
+
+func (s *seriesState) series() []metricsInterface.Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.labels))
+	for key := range s.labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]metricsInterface.Sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, s.sample(key))
+	}
+	return samples
+}
+
+func (s *seriesState) delete(labels map[string]string) bool {
+	key := metricsInterface.SeriesKey(labels)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.labels[key]; !ok {
+		return false
+	}
+	delete(s.values, key)
+	delete(s.counts, key)
+	delete(s.labels, key)
+	return true
+}
+
+func (s *seriesState) deletePartialMatch(labels map[string]string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, series := range s.labels {
+		if metricsInterface.MatchesLabels(series, labels) {
+			delete(s.values, key)
+			delete(s.counts, key)
+			delete(s.labels, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
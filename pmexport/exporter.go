@@ -0,0 +1,335 @@
+package pmexport
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metrics_wrapper"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMeasInfo groups KPIs without an nf_type.
+const DefaultMeasInfo = "Other"
+
+// Config controls where and how measurement files are written.
+type Config struct {
+	// Dir receives the files; it is created if missing.
+	Dir string
+	// VendorName, DNPrefix, LocalDN and ElementType fill the file header,
+	// e.g. "DC=operator.com,SubNetwork=1", "ManagedElement=amf-1", "AMF".
+	VendorName  string
+	DNPrefix    string
+	LocalDN     string
+	ElementType string
+	SwVersion   string
+	// MaxFiles keeps at most this many files, deleting the oldest (0 = no limit).
+	MaxFiles int
+	// MaxAge deletes files older than this (0 = no limit).
+	MaxAge time.Duration
+}
+
+// XMLExporter writes PM job period reports as TS 32.435 measCollec files,
+// named as in TS 32.432: A<begin date>.<begin time>-<end time>_<sender>.xml.
+type XMLExporter struct {
+	cfg Config
+
+	// mu serializes Export, which picks a free file name and then renames
+	// onto it; OnReport may be called by several PM jobs at once.
+	mu sync.Mutex
+}
+
+func NewXMLExporter(cfg Config) (*XMLExporter, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("measurement file directory is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", cfg.Dir, err)
+	}
+	return &XMLExporter{cfg: cfg}, nil
+}
+
+// OnReport exports report and logs failures, for use in
+// metrics_wrapper.PMJobConfig.OnReport.
+func (e *XMLExporter) OnReport(report metrics_wrapper.PeriodReport) {
+	path, err := e.Export(report)
+	if err != nil {
+		log.Printf("Failed to export PM report of job %s: %v", report.Job, err)
+		return
+	}
+	log.Printf("Wrote measurement file %s", path)
+}
+
+// Export writes one file for report, applies the rotation and retention
+// limits and returns the path of the new file.
+func (e *XMLExporter) Export(report metrics_wrapper.PeriodReport) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	body, err := xml.MarshalIndent(e.file(report), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode measurement file: %w", err)
+	}
+	content := append([]byte(xml.Header), body...)
+	content = append(content, '\n')
+
+	path := e.path(report)
+	tmp, err := os.CreateTemp(e.cfg.Dir, ".measCollec-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := e.prune(time.Now()); err != nil {
+		log.Printf("Failed to prune measurement files in %s: %v", e.cfg.Dir, err)
+	}
+	return path, nil
+}
+
+func (e *XMLExporter) file(report metrics_wrapper.PeriodReport) measCollecFile {
+	begin, end := formatTime(report.Start), formatTime(report.End)
+	duration := fmt.Sprintf("PT%dS", int(report.End.Sub(report.Start).Round(time.Second).Seconds()))
+	if granularity, err := time.ParseDuration(report.Granularity); err == nil {
+		duration = fmt.Sprintf("PT%dS", int(granularity.Seconds()))
+	}
+
+	data := measData{ManagedElement: managedElement{
+		LocalDN:   e.cfg.LocalDN,
+		UserLabel: e.cfg.ElementType,
+		SwVersion: e.cfg.SwVersion,
+	}}
+	for _, group := range groupByNFType(report.Measurements) {
+		info := measInfo{
+			MeasInfoID: group.nfType,
+			Job:        &job{JobID: report.Job},
+			GranPeriod: granPeriod{Duration: duration, EndTime: end},
+			RepPeriod:  repPeriod{Duration: duration},
+		}
+		e.addMeasurements(&info, group.measurements)
+		data.MeasInfo = append(data.MeasInfo, info)
+	}
+
+	return measCollecFile{
+		Xmlns: measCollecNS,
+		FileHeader: fileHeader{
+			FileFormatVersion: FileFormatVersion,
+			VendorName:        e.cfg.VendorName,
+			DNPrefix:          e.cfg.DNPrefix,
+			FileSender:        fileSender{LocalDN: e.cfg.LocalDN, ElementType: e.cfg.ElementType},
+			MeasCollec:        beginTime{BeginTime: begin},
+		},
+		MeasData:   []measData{data},
+		FileFooter: fileFooter{MeasCollec: endTime{EndTime: end}},
+	}
+}
+
+type nfGroup struct {
+	nfType       string
+	measurements []metrics_wrapper.Measurement
+}
+
+func groupByNFType(measurements []metrics_wrapper.Measurement) []nfGroup {
+	index := make(map[string]int)
+	var groups []nfGroup
+	for _, m := range measurements {
+		nfType := m.NFType
+		if nfType == "" {
+			nfType = DefaultMeasInfo
+		}
+		i, ok := index[nfType]
+		if !ok {
+			i = len(groups)
+			index[nfType] = i
+			groups = append(groups, nfGroup{nfType: nfType})
+		}
+		groups[i].measurements = append(groups[i].measurements, m)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].nfType < groups[j].nfType })
+	return groups
+}
+
+// addMeasurements lists every KPI as a measType and every measured object
+// (label set) as a measValue carrying the results it has. Histograms and
+// summaries are reported as <kpi>.Sum and <kpi>.Count.
+func (e *XMLExporter) addMeasurements(info *measInfo, measurements []metrics_wrapper.Measurement) {
+	values := make(map[string]*measValue)
+	var ldns []string
+	addResult := func(ldn string, p int, v float64) {
+		mv, ok := values[ldn]
+		if !ok {
+			suspect := false
+			mv = &measValue{MeasObjLdn: ldn, Suspect: &suspect}
+			values[ldn] = mv
+			ldns = append(ldns, ldn)
+		}
+		value, ok := formatValue(v)
+		if !ok {
+			// TS 32.435: a result that could not be computed is NIL and the
+			// measured object is flagged suspect
+			value = "NIL"
+			*mv.Suspect = true
+		}
+		mv.Results = append(mv.Results, measRes{P: p, Value: value})
+	}
+
+	for _, m := range measurements {
+		name := m.KPI
+		if name == "" {
+			name = m.Metric
+		}
+		distribution := m.Type == metricsInterface.HistogramType || m.Type == metricsInterface.SummaryType
+
+		p := len(info.MeasTypes) + 1
+		if distribution {
+			info.MeasTypes = append(info.MeasTypes,
+				measType{P: p, Name: name + ".Sum"}, measType{P: p + 1, Name: name + ".Count"})
+		} else {
+			info.MeasTypes = append(info.MeasTypes, measType{P: p, Name: name})
+		}
+
+		for _, sample := range m.Series {
+			ldn := e.measObjLdn(m.LabelNames, sample.Labels)
+			if distribution {
+				addResult(ldn, p, sample.Sum)
+				addResult(ldn, p+1, float64(sample.Count))
+			} else {
+				addResult(ldn, p, sample.Value)
+			}
+		}
+	}
+
+	sort.Strings(ldns)
+	for _, ldn := range ldns {
+		info.MeasValues = append(info.MeasValues, *values[ldn])
+	}
+}
+
+// measObjLdn names the measured object: the local DN followed by the object
+// labels in catalogue order, e.g. ManagedElement=amf-1,NetworkSlice=1-000001.
+func (e *XMLExporter) measObjLdn(names []string, labels map[string]string) string {
+	parts := make([]string, 0, len(names)+1)
+	if e.cfg.LocalDN != "" {
+		parts = append(parts, e.cfg.LocalDN)
+	}
+	for _, name := range names {
+		if value, ok := labels[name]; ok {
+			parts = append(parts, name+"="+escapeRDN(value))
+		}
+	}
+	if len(parts) == 0 {
+		return e.cfg.ElementType
+	}
+	return strings.Join(parts, ",")
+}
+
+// escapeRDN escapes the characters with a meaning in a DN (TS 32.300).
+func escapeRDN(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`, `+`, `\+`).Replace(value)
+}
+
+func (e *XMLExporter) path(report metrics_wrapper.PeriodReport) string {
+	name := fmt.Sprintf("A%s.%s-%s", report.Start.Format("20060102"), report.Start.Format("1504-0700"), report.End.Format("1504-0700"))
+	if sender := fileNameSafe(e.cfg.LocalDN); sender != "" {
+		name += "_" + sender
+	}
+
+	// TS 32.432 running count for several files of the same period
+	path := filepath.Join(e.cfg.Dir, name+".xml")
+	for rc := 1; fileExists(path); rc++ {
+		path = filepath.Join(e.cfg.Dir, fmt.Sprintf("%s_-_%d.xml", name, rc))
+	}
+	return path
+}
+
+// prune enforces MaxAge and MaxFiles on the measurement files in Dir.
+func (e *XMLExporter) prune(now time.Time) error {
+	if e.cfg.MaxFiles <= 0 && e.cfg.MaxAge <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(e.cfg.Dir, "A*.xml"))
+	if err != nil {
+		return err
+	}
+	type measFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []measFile
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if e.cfg.MaxAge > 0 && now.Sub(info.ModTime()) > e.cfg.MaxAge {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		files = append(files, measFile{path: path, modTime: info.ModTime()})
+	}
+
+	if e.cfg.MaxFiles <= 0 || len(files) <= e.cfg.MaxFiles {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].path < files[j].path
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files[:len(files)-e.cfg.MaxFiles] {
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05-07:00")
+}
+
+// formatValue renders a result; ok is false for NaN and infinities, e.g. a
+// derived KPI dividing by zero, which have no representation in the file.
+func formatValue(v float64) (string, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", false
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), true
+}
+
+func fileNameSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
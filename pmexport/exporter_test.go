@@ -0,0 +1,192 @@
+package pmexport
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metrics_wrapper"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testReport = metrics_wrapper.PeriodReport{
+	Job:         "job1",
+	Granularity: "15m0s",
+	Start:       time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+	End:         time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC),
+	Measurements: []metrics_wrapper.Measurement{
+		{
+			Metric:     "registration_attempts",
+			KPI:        "RM.RegAtt",
+			NFType:     "AMF",
+			Type:       metricsInterface.CounterType,
+			LabelNames: []string{"NetworkSlice"},
+			Series: []metricsInterface.Sample{
+				{Labels: map[string]string{"NetworkSlice": "1-000002"}, Value: 7},
+				{Labels: map[string]string{"NetworkSlice": "1-000001"}, Value: 42},
+			},
+		},
+		{
+			Metric:     "registration_success_rate",
+			KPI:        "RM.RegSuccRate",
+			NFType:     "AMF",
+			Type:       metricsInterface.GaugeType,
+			LabelNames: []string{"NetworkSlice"},
+			Series: []metricsInterface.Sample{
+				{Labels: map[string]string{"NetworkSlice": "1-000001"}, Value: 97.5},
+				{Labels: map[string]string{"NetworkSlice": "1-000002"}, Value: math.NaN()},
+			},
+		},
+		{
+			Metric: "pdu_setup_time",
+			NFType: "SMF",
+			Type:   metricsInterface.HistogramType,
+			Series: []metricsInterface.Sample{{Labels: map[string]string{}, Count: 3, Sum: 0.75}},
+		},
+	},
+}
+
+const wantFile = `<?xml version="1.0" encoding="UTF-8"?>
+<measCollecFile xmlns="http://www.3gpp.org/ftp/specs/archive/32_series/32.435#measCollec">
+  <fileHeader fileFormatVersion="32.435 V10.0" vendorName="Amantya" dnPrefix="DC=operator.com">
+    <fileSender localDn="ManagedElement=amf-1" elementType="AMF"></fileSender>
+    <measCollec beginTime="2025-01-01T10:00:00+00:00"></measCollec>
+  </fileHeader>
+  <measData>
+    <managedElement localDn="ManagedElement=amf-1" userLabel="AMF" swVersion="1.2.0"></managedElement>
+    <measInfo measInfoId="AMF">
+      <job jobId="job1"></job>
+      <granPeriod duration="PT900S" endTime="2025-01-01T10:15:00+00:00"></granPeriod>
+      <repPeriod duration="PT900S"></repPeriod>
+      <measType p="1">RM.RegAtt</measType>
+      <measType p="2">RM.RegSuccRate</measType>
+      <measValue measObjLdn="ManagedElement=amf-1,NetworkSlice=1-000001">
+        <r p="1">42</r>
+        <r p="2">97.5</r>
+        <suspect>false</suspect>
+      </measValue>
+      <measValue measObjLdn="ManagedElement=amf-1,NetworkSlice=1-000002">
+        <r p="1">7</r>
+        <r p="2">NIL</r>
+        <suspect>true</suspect>
+      </measValue>
+    </measInfo>
+    <measInfo measInfoId="SMF">
+      <job jobId="job1"></job>
+      <granPeriod duration="PT900S" endTime="2025-01-01T10:15:00+00:00"></granPeriod>
+      <repPeriod duration="PT900S"></repPeriod>
+      <measType p="1">pdu_setup_time.Sum</measType>
+      <measType p="2">pdu_setup_time.Count</measType>
+      <measValue measObjLdn="ManagedElement=amf-1">
+        <r p="1">0.75</r>
+        <r p="2">3</r>
+        <suspect>false</suspect>
+      </measValue>
+    </measInfo>
+  </measData>
+  <fileFooter>
+    <measCollec endTime="2025-01-01T10:15:00+00:00"></measCollec>
+  </fileFooter>
+</measCollecFile>
+`
+
+func newTestExporter(t *testing.T, cfg Config) *XMLExporter {
+	t.Helper()
+
+	cfg.Dir = t.TempDir()
+	cfg.VendorName = "Amantya"
+	cfg.DNPrefix = "DC=operator.com"
+	cfg.LocalDN = "ManagedElement=amf-1"
+	cfg.ElementType = "AMF"
+	cfg.SwVersion = "1.2.0"
+	e, err := NewXMLExporter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestExport(t *testing.T) {
+	e := newTestExporter(t, Config{})
+
+	path, err := e.Export(testReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "A20250101.1000+0000-1015+0000_ManagedElement=amf-1.xml"; filepath.Base(path) != want {
+		t.Errorf("file name %s, want %s", filepath.Base(path), want)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != wantFile {
+		t.Errorf("file content:\n%s\nwant:\n%s", got, wantFile)
+	}
+}
+
+func TestExportConcurrentSamePeriod(t *testing.T) {
+	e := newTestExporter(t, Config{})
+
+	const reports = 8
+	paths := make([]string, reports)
+	var wg sync.WaitGroup
+	for i := range reports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path, err := e.Export(testReport)
+			if err != nil {
+				t.Error(err)
+			}
+			paths[i] = filepath.Base(path)
+		}()
+	}
+	wg.Wait()
+
+	files, err := filepath.Glob(filepath.Join(e.cfg.Dir, "A*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != reports {
+		t.Errorf("got %d files for %d reports of the same period: %v", len(files), reports, paths)
+	}
+	want := []string{"A20250101.1000+0000-1015+0000_ManagedElement=amf-1.xml"}
+	for rc := 1; rc < reports; rc++ {
+		want = append(want, fmt.Sprintf("A20250101.1000+0000-1015+0000_ManagedElement=amf-1_-_%d.xml", rc))
+	}
+	sort.Strings(paths)
+	sort.Strings(want)
+	if !slices.Equal(paths, want) {
+		t.Errorf("file names %v, want %v", paths, want)
+	}
+}
+
+func TestExportMaxFiles(t *testing.T) {
+	e := newTestExporter(t, Config{MaxFiles: 2})
+
+	report := testReport
+	for i := range 4 {
+		report.Start = testReport.Start.Add(time.Duration(i) * 15 * time.Minute)
+		report.End = report.Start.Add(15 * time.Minute)
+		if _, err := e.Export(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(e.cfg.Dir, "A*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("kept %d files, want 2", len(files))
+	}
+	if want := "A20250101.1030+0000-1045+0000_ManagedElement=amf-1.xml"; filepath.Base(files[0]) != want {
+		t.Errorf("oldest kept file %s, want %s", filepath.Base(files[0]), want)
+	}
+}
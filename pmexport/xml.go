@@ -0,0 +1,91 @@
+package pmexport
+
+import "encoding/xml"
+
+// Namespace of the TS 32.435 measurement collection file schema.
+const measCollecNS = "http://www.3gpp.org/ftp/specs/archive/32_series/32.435#measCollec"
+
+// FileFormatVersion is written to every file header.
+const FileFormatVersion = "32.435 V10.0"
+
+type measCollecFile struct {
+	XMLName    xml.Name   `xml:"measCollecFile"`
+	Xmlns      string     `xml:"xmlns,attr"`
+	FileHeader fileHeader `xml:"fileHeader"`
+	MeasData   []measData `xml:"measData"`
+	FileFooter fileFooter `xml:"fileFooter"`
+}
+
+type fileHeader struct {
+	FileFormatVersion string     `xml:"fileFormatVersion,attr"`
+	VendorName        string     `xml:"vendorName,attr,omitempty"`
+	DNPrefix          string     `xml:"dnPrefix,attr,omitempty"`
+	FileSender        fileSender `xml:"fileSender"`
+	MeasCollec        beginTime  `xml:"measCollec"`
+}
+
+type fileSender struct {
+	LocalDN     string `xml:"localDn,attr,omitempty"`
+	ElementType string `xml:"elementType,attr,omitempty"`
+}
+
+type beginTime struct {
+	BeginTime string `xml:"beginTime,attr"`
+}
+
+type endTime struct {
+	EndTime string `xml:"endTime,attr"`
+}
+
+type fileFooter struct {
+	MeasCollec endTime `xml:"measCollec"`
+}
+
+type measData struct {
+	ManagedElement managedElement `xml:"managedElement"`
+	MeasInfo       []measInfo     `xml:"measInfo"`
+}
+
+type managedElement struct {
+	LocalDN   string `xml:"localDn,attr,omitempty"`
+	UserLabel string `xml:"userLabel,attr,omitempty"`
+	SwVersion string `xml:"swVersion,attr,omitempty"`
+}
+
+type measInfo struct {
+	MeasInfoID string      `xml:"measInfoId,attr,omitempty"`
+	Job        *job        `xml:"job"`
+	GranPeriod granPeriod  `xml:"granPeriod"`
+	RepPeriod  repPeriod   `xml:"repPeriod"`
+	MeasTypes  []measType  `xml:"measType"`
+	MeasValues []measValue `xml:"measValue"`
+}
+
+type job struct {
+	JobID string `xml:"jobId,attr"`
+}
+
+type granPeriod struct {
+	Duration string `xml:"duration,attr"`
+	EndTime  string `xml:"endTime,attr"`
+}
+
+type repPeriod struct {
+	Duration string `xml:"duration,attr"`
+}
+
+type measType struct {
+	P    int    `xml:"p,attr"`
+	Name string `xml:",chardata"`
+}
+
+type measValue struct {
+	MeasObjLdn string    `xml:"measObjLdn,attr"`
+	Results    []measRes `xml:"r"`
+	Suspect    *bool     `xml:"suspect"`
+}
+
+type measRes struct {
+	P     int    `xml:"p,attr"`
+	Value string `xml:",chardata"`
+}
@@ -3,19 +3,26 @@ package prometheusbackend
 import (
 	"amantya_metrics/metricsInterface"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 type PrometheusCounter struct {
 	counter *prometheus.CounterVec
+	labels  []string
 }
 
 func (pc *PrometheusCounter) Inc(labels map[string]string) error {
-	pc.counter.With(labels).Inc()
+	series, err := pc.counter.GetMetricWith(labels)
+	if err != nil {
+		return labelError(pc.labels, labels, err)
+	}
+	series.Inc()
 	return nil
 }
 
@@ -24,7 +31,14 @@ func (pc *PrometheusCounter) Dec(labels map[string]string) error {
 }
 
 func (pc *PrometheusCounter) Add(value float64, labels map[string]string) error {
-	pc.counter.With(labels).Add(value)
+	if value < 0 {
+		return fmt.Errorf("%w: counter cannot decrease", metricsInterface.ErrInvalidOperation)
+	}
+	series, err := pc.counter.GetMetricWith(labels)
+	if err != nil {
+		return labelError(pc.labels, labels, err)
+	}
+	series.Add(value)
 	return nil
 }
 
@@ -40,27 +54,60 @@ func (pc *PrometheusCounter) GetMetricType() metricsInterface.MetricType {
 	return metricsInterface.CounterType
 }
 
+func (pc *PrometheusCounter) DeleteSeries(labels map[string]string) bool {
+	return pc.counter.Delete(labels)
+}
+
+func (pc *PrometheusCounter) DeletePartialMatch(labels map[string]string) int {
+	return pc.counter.DeletePartialMatch(labels)
+}
+
+func (pc *PrometheusCounter) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return findSample(pc.counter, pc.labels, labels)
+}
+
+func (pc *PrometheusCounter) Series() ([]metricsInterface.Sample, error) {
+	return collectSamples(pc.counter, pc.labels)
+}
+
 type PrometheusGauge struct {
-	gauge *prometheus.GaugeVec
+	gauge  *prometheus.GaugeVec
+	labels []string
 }
 
 func (pg *PrometheusGauge) Inc(labels map[string]string) error {
-	pg.gauge.With(labels).Inc()
+	series, err := pg.gauge.GetMetricWith(labels)
+	if err != nil {
+		return labelError(pg.labels, labels, err)
+	}
+	series.Inc()
 	return nil
 }
 
 func (pg *PrometheusGauge) Dec(labels map[string]string) error {
-	pg.gauge.With(labels).Dec()
+	series, err := pg.gauge.GetMetricWith(labels)
+	if err != nil {
+		return labelError(pg.labels, labels, err)
+	}
+	series.Dec()
 	return nil
 }
 
 func (pg *PrometheusGauge) Add(value float64, labels map[string]string) error {
-	pg.gauge.With(labels).Add(value)
+	series, err := pg.gauge.GetMetricWith(labels)
+	if err != nil {
+		return labelError(pg.labels, labels, err)
+	}
+	series.Add(value)
 	return nil
 }
 
 func (pg *PrometheusGauge) Set(value float64, labels map[string]string) error {
-	pg.gauge.With(labels).Set(value)
+	series, err := pg.gauge.GetMetricWith(labels)
+	if err != nil {
+		return labelError(pg.labels, labels, err)
+	}
+	series.Set(value)
 	return nil
 }
 
@@ -72,8 +119,134 @@ func (pg *PrometheusGauge) GetMetricType() metricsInterface.MetricType {
 	return metricsInterface.GaugeType
 }
 
+func (pg *PrometheusGauge) DeleteSeries(labels map[string]string) bool {
+	return pg.gauge.Delete(labels)
+}
+
+func (pg *PrometheusGauge) DeletePartialMatch(labels map[string]string) int {
+	return pg.gauge.DeletePartialMatch(labels)
+}
+
+func (pg *PrometheusGauge) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return findSample(pg.gauge, pg.labels, labels)
+}
+
+func (pg *PrometheusGauge) Series() ([]metricsInterface.Sample, error) {
+	return collectSamples(pg.gauge, pg.labels)
+}
+
+type PrometheusHistogram struct {
+	histogram *prometheus.HistogramVec
+	labels    []string
+}
+
+func (ph *PrometheusHistogram) Inc(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ph *PrometheusHistogram) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ph *PrometheusHistogram) Add(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ph *PrometheusHistogram) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ph *PrometheusHistogram) Observe(value float64, labels map[string]string) error {
+	series, err := ph.histogram.GetMetricWith(labels)
+	if err != nil {
+		return labelError(ph.labels, labels, err)
+	}
+	series.Observe(value)
+	return nil
+}
+
+func (ph *PrometheusHistogram) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.HistogramType
+}
+
+func (ph *PrometheusHistogram) DeleteSeries(labels map[string]string) bool {
+	return ph.histogram.Delete(labels)
+}
+
+func (ph *PrometheusHistogram) DeletePartialMatch(labels map[string]string) int {
+	return ph.histogram.DeletePartialMatch(labels)
+}
+
+func (ph *PrometheusHistogram) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return findSample(ph.histogram, ph.labels, labels)
+}
+
+func (ph *PrometheusHistogram) Series() ([]metricsInterface.Sample, error) {
+	return collectSamples(ph.histogram, ph.labels)
+}
+
+type PrometheusSummary struct {
+	summary *prometheus.SummaryVec
+	labels  []string
+}
+
+func (ps *PrometheusSummary) Inc(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ps *PrometheusSummary) Dec(labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ps *PrometheusSummary) Add(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ps *PrometheusSummary) Set(value float64, labels map[string]string) error {
+	return metricsInterface.ErrInvalidOperation
+}
+
+func (ps *PrometheusSummary) Observe(value float64, labels map[string]string) error {
+	series, err := ps.summary.GetMetricWith(labels)
+	if err != nil {
+		return labelError(ps.labels, labels, err)
+	}
+	series.Observe(value)
+	return nil
+}
+
+func (ps *PrometheusSummary) GetMetricType() metricsInterface.MetricType {
+	return metricsInterface.SummaryType
+}
+
+func (ps *PrometheusSummary) DeleteSeries(labels map[string]string) bool {
+	return ps.summary.Delete(labels)
+}
+
+func (ps *PrometheusSummary) DeletePartialMatch(labels map[string]string) int {
+	return ps.summary.DeletePartialMatch(labels)
+}
+
+func (ps *PrometheusSummary) Value(labels map[string]string) (metricsInterface.Sample, error) {
+	return findSample(ps.summary, ps.labels, labels)
+}
+
+func (ps *PrometheusSummary) Series() ([]metricsInterface.Sample, error) {
+	return collectSamples(ps.summary, ps.labels)
+}
+
+// labelError explains why a label lookup failed: a label set that does not
+// match the metric is reported with the missing and unexpected names.
+func labelError(expected []string, labels map[string]string, err error) error {
+	if mismatch := metricsInterface.CheckLabels(expected, labels); mismatch != nil {
+		return mismatch
+	}
+	return fmt.Errorf("%w: %v", metricsInterface.ErrInvalidLabel, err)
+}
+
 type PrometheusBackend struct {
-	registry *prometheus.Registry
+	registry    *prometheus.Registry
+	constLabels prometheus.Labels
 }
 
 func NewPrometheusBackend() *PrometheusBackend {
@@ -82,48 +255,138 @@ func NewPrometheusBackend() *PrometheusBackend {
 	}
 }
 
+// WithConstLabels returns a view of the backend that attaches labels as
+// ConstLabels to every metric it creates. The registry is shared.
+func (pb *PrometheusBackend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	return &PrometheusBackend{
+		registry:    pb.registry,
+		constLabels: prometheus.Labels(labels),
+	}
+}
+
 func (pb *PrometheusBackend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
 	counter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: name,
-			Help: help,
+			Name:        name,
+			Help:        help,
+			ConstLabels: pb.constLabels,
 		},
 		labels,
 	)
 
 	if err := pb.registry.Register(counter); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-			existing := are.ExistingCollector.(*prometheus.CounterVec)
-			return &PrometheusCounter{counter: existing}, nil
+			if existing, ok := are.ExistingCollector.(*prometheus.CounterVec); ok {
+				return &PrometheusCounter{counter: existing, labels: labels}, nil
+			}
+			return nil, fmt.Errorf("%w: %s is not a counter", metricsInterface.ErrMetricAlreadyRegistered, name)
 		}
 		return nil, err
 	}
 
-	return &PrometheusCounter{counter: counter}, nil
+	return &PrometheusCounter{counter: counter, labels: labels}, nil
 }
 
 func (pb *PrometheusBackend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
 	gauge := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: name,
-			Help: help,
+			Name:        name,
+			Help:        help,
+			ConstLabels: pb.constLabels,
 		},
 		labels,
 	)
 
 	if err := pb.registry.Register(gauge); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-			existing := are.ExistingCollector.(*prometheus.GaugeVec)
-			return &PrometheusGauge{gauge: existing}, nil
+			if existing, ok := are.ExistingCollector.(*prometheus.GaugeVec); ok {
+				return &PrometheusGauge{gauge: existing, labels: labels}, nil
+			}
+			return nil, fmt.Errorf("%w: %s is not a gauge", metricsInterface.ErrMetricAlreadyRegistered, name)
 		}
 		return nil, err
 	}
 
-	return &PrometheusGauge{gauge: gauge}, nil
+	return &PrometheusGauge{gauge: gauge, labels: labels}, nil
 }
 
 func (pb *PrometheusBackend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
-	return nil, metricsInterface.ErrBackendNotSupported
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	histogram := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:        name,
+			Help:        help,
+			Buckets:     buckets,
+			ConstLabels: pb.constLabels,
+		},
+		labels,
+	)
+
+	if err := pb.registry.Register(histogram); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			if existing, ok := are.ExistingCollector.(*prometheus.HistogramVec); ok {
+				return &PrometheusHistogram{histogram: existing, labels: labels}, nil
+			}
+			return nil, fmt.Errorf("%w: %s is not a histogram", metricsInterface.ErrMetricAlreadyRegistered, name)
+		}
+		return nil, err
+	}
+
+	return &PrometheusHistogram{histogram: histogram, labels: labels}, nil
+}
+
+// defaultObjectives tracks p50, p90 and p99 when a KPI does not declare its own.
+var defaultObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+func (pb *PrometheusBackend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	if len(objectives) == 0 {
+		objectives = defaultObjectives
+	}
+	if maxAge <= 0 {
+		maxAge = prometheus.DefMaxAge
+	}
+
+	summary := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:        name,
+			Help:        help,
+			Objectives:  objectives,
+			MaxAge:      maxAge,
+			ConstLabels: pb.constLabels,
+		},
+		labels,
+	)
+
+	if err := pb.registry.Register(summary); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			if existing, ok := are.ExistingCollector.(*prometheus.SummaryVec); ok {
+				return &PrometheusSummary{summary: existing, labels: labels}, nil
+			}
+			return nil, fmt.Errorf("%w: %s is not a summary", metricsInterface.ErrMetricAlreadyRegistered, name)
+		}
+		return nil, err
+	}
+
+	return &PrometheusSummary{summary: summary, labels: labels}, nil
+}
+
+// Handler serves the backend registry for Prometheus to scrape, negotiating
+// the OpenMetrics format when the scraper asks for it.
+func (pb *PrometheusBackend) Handler() http.Handler {
+	return promhttp.HandlerFor(pb.registry, promhttp.HandlerOpts{
+		ErrorLog:          log.Default(),
+		ErrorHandling:     promhttp.ContinueOnError,
+		EnableOpenMetrics: true,
+	})
+}
+
+// Gatherer returns the backend registry, for backends such as remote write
+// that send its contents elsewhere.
+func (pb *PrometheusBackend) Gatherer() prometheus.Gatherer {
+	return pb.registry
 }
 
 func (pb *PrometheusBackend) PushToGateway(gatewayURL, jobName string) error {
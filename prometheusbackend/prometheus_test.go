@@ -0,0 +1,264 @@
+package prometheusbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the series of name in the backend registry.
+func gather(t *testing.T, pb *PrometheusBackend, name string) []*dto.Metric {
+	t.Helper()
+
+	families, err := pb.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf.GetMetric()
+		}
+	}
+	t.Fatalf("%s is not in the registry", name)
+	return nil
+}
+
+func TestHistogram(t *testing.T) {
+	pb := NewPrometheusBackend()
+	h, err := pb.NewHistogram("setup_time", "Setup time", []string{"Cause"}, []float64{0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.GetMetricType() != metricsInterface.HistogramType {
+		t.Errorf("GetMetricType() = %v, want HistogramType", h.GetMetricType())
+	}
+	for _, v := range []float64{0.05, 0.5, 0.5, 3} {
+		if err := h.Observe(v, map[string]string{"Cause": "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range []error{h.Inc(nil), h.Dec(nil), h.Add(1, nil), h.Set(1, nil)} {
+		if !errors.Is(err, metricsInterface.ErrInvalidOperation) {
+			t.Errorf("non-observe operation on a histogram: got %v, want ErrInvalidOperation", err)
+		}
+	}
+
+	series := gather(t, pb, "setup_time")
+	if len(series) != 1 {
+		t.Fatalf("got %d series, want 1", len(series))
+	}
+	got := series[0].GetHistogram()
+	if got.GetSampleCount() != 4 || got.GetSampleSum() != 4.05 {
+		t.Errorf("count %d, sum %v, want 4 and 4.05", got.GetSampleCount(), got.GetSampleSum())
+	}
+	var bounds []float64
+	var counts []uint64
+	for _, b := range got.GetBucket() {
+		bounds = append(bounds, b.GetUpperBound())
+		counts = append(counts, b.GetCumulativeCount())
+	}
+	if !slices.Equal(bounds, []float64{0.1, 1}) || !slices.Equal(counts, []uint64{1, 3}) {
+		t.Errorf("buckets %v with counts %v, want [0.1 1] with [1 3]", bounds, counts)
+	}
+}
+
+func TestHistogramDefaultBuckets(t *testing.T) {
+	pb := NewPrometheusBackend()
+	h, err := pb.NewHistogram("setup_time", "Setup time", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Observe(0.2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(gather(t, pb, "setup_time")[0].GetHistogram().GetBucket()); got != 11 {
+		t.Errorf("got %d buckets, want the 11 default buckets", got)
+	}
+}
+
+func TestRegisterAgain(t *testing.T) {
+	pb := NewPrometheusBackend()
+	first, err := pb.NewHistogram("setup_time", "Setup time", nil, []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pb.NewHistogram("setup_time", "Setup time", nil, []float64{1})
+	if err != nil {
+		t.Fatalf("registering the same histogram again: %v", err)
+	}
+	first.Observe(0.5, nil)
+	second.Observe(0.5, nil)
+	if got := gather(t, pb, "setup_time")[0].GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("got %d observations, want both on the registered histogram", got)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	pb := NewPrometheusBackend()
+	s, err := pb.NewSummary("latency", "Latency", nil, map[float64]float64{0.5: 0.05, 0.99: 0.001}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetMetricType() != metricsInterface.SummaryType {
+		t.Errorf("GetMetricType() = %v, want SummaryType", s.GetMetricType())
+	}
+	for i := 1; i <= 100; i++ {
+		if err := s.Observe(float64(i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := gather(t, pb, "latency")[0].GetSummary()
+	if got.GetSampleCount() != 100 || got.GetSampleSum() != 5050 {
+		t.Errorf("count %d, sum %v, want 100 and 5050", got.GetSampleCount(), got.GetSampleSum())
+	}
+	quantiles := map[float64]float64{}
+	for _, q := range got.GetQuantile() {
+		quantiles[q.GetQuantile()] = q.GetValue()
+	}
+	if len(quantiles) != 2 || quantiles[0.5] != 50 || quantiles[0.99] != 99 {
+		t.Errorf("quantiles %v, want p50 50 and p99 99", quantiles)
+	}
+}
+
+func TestSummaryDefaultObjectives(t *testing.T) {
+	pb := NewPrometheusBackend()
+	s, err := pb.NewSummary("latency", "Latency", nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Observe(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []float64
+	for _, q := range gather(t, pb, "latency")[0].GetSummary().GetQuantile() {
+		got = append(got, q.GetQuantile())
+	}
+	if !slices.Equal(got, []float64{0.5, 0.9, 0.99}) {
+		t.Errorf("quantiles %v, want the p50, p90 and p99 defaults", got)
+	}
+}
+
+func TestLabelMismatch(t *testing.T) {
+	pb := NewPrometheusBackend()
+	names := []string{"NetworkSlice", "Cause"}
+	counter, _ := pb.NewCounter("registrations", "", names)
+	gauge, _ := pb.NewGauge("active_sessions", "", names)
+	histogram, _ := pb.NewHistogram("setup_time", "", names, nil)
+	summary, _ := pb.NewSummary("latency", "", names, nil, 0)
+
+	ops := map[string]func(labels map[string]string) error{
+		"counter Inc":       counter.Inc,
+		"counter Add":       func(l map[string]string) error { return counter.Add(1, l) },
+		"gauge Dec":         gauge.Dec,
+		"gauge Set":         func(l map[string]string) error { return gauge.Set(1, l) },
+		"histogram Observe": func(l map[string]string) error { return histogram.Observe(1, l) },
+		"summary Observe":   func(l map[string]string) error { return summary.Observe(1, l) },
+	}
+	tests := []struct {
+		labels map[string]string
+		want   string
+	}{
+		{map[string]string{"NetworkSlice": "slice1"}, "missing Cause"},
+		{nil, "missing NetworkSlice, Cause"},
+		{map[string]string{"NetworkSlice": "slice1", "Cause": "ok", "Site": "lab"}, "unexpected Site"},
+		{map[string]string{"NetworkSlice": "slice1", "Site": "lab"}, "missing Cause; unexpected Site"},
+	}
+	for name, op := range ops {
+		for _, tt := range tests {
+			err := op(tt.labels)
+			if !errors.Is(err, metricsInterface.ErrInvalidLabel) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s with %v: got %v, want ErrInvalidLabel with %q", name, tt.labels, err, tt.want)
+			}
+		}
+		if err := op(map[string]string{"NetworkSlice": "slice1", "Cause": "ok"}); err != nil {
+			t.Errorf("%s with the declared labels: %v", name, err)
+		}
+	}
+}
+
+func TestReadBack(t *testing.T) {
+	pb := NewPrometheusBackend().WithConstLabels(map[string]string{"site": "lab"})
+	counter, err := pb.NewCounter("registrations", "", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	histogram, err := pb.NewHistogram("setup_time", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(2, map[string]string{"NetworkSlice": "slice2"})
+	counter.Inc(map[string]string{"NetworkSlice": "slice1"})
+	histogram.Observe(0.5, nil)
+	histogram.Observe(1.5, nil)
+
+	// The constant site label is left out of the samples
+	got, err := counter.Value(map[string]string{"NetworkSlice": "slice2"})
+	if err != nil || got.Value != 2 || len(got.Labels) != 1 {
+		t.Errorf("Value(slice2) = %+v, %v, want 2 with only the NetworkSlice label", got, err)
+	}
+	series, err := counter.Series()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var networkSlices []string
+	for _, s := range series {
+		networkSlices = append(networkSlices, s.Labels["NetworkSlice"])
+	}
+	if !slices.Equal(networkSlices, []string{"slice1", "slice2"}) {
+		t.Errorf("Series() gave slices %v, want [slice1 slice2]", networkSlices)
+	}
+	if got, err := histogram.Value(nil); err != nil || got.Count != 2 || got.Sum != 2 {
+		t.Errorf("histogram Value() = %+v, %v, want count 2 and sum 2", got, err)
+	}
+
+	if _, err := counter.Value(map[string]string{"NetworkSlice": "slice3"}); !errors.Is(err, metricsInterface.ErrSeriesNotFound) {
+		t.Errorf("Value of an unwritten series: got %v, want ErrSeriesNotFound", err)
+	}
+	if _, err := counter.Value(nil); !errors.Is(err, metricsInterface.ErrInvalidLabel) {
+		t.Errorf("Value with missing labels: got %v, want ErrInvalidLabel", err)
+	}
+}
+
+// create registers a metric of the given kind called name.
+func create(pb *PrometheusBackend, kind, name string) error {
+	var err error
+	switch kind {
+	case "counter":
+		_, err = pb.NewCounter(name, "", nil)
+	case "gauge":
+		_, err = pb.NewGauge(name, "", nil)
+	case "histogram":
+		_, err = pb.NewHistogram(name, "", nil, nil)
+	case "summary":
+		_, err = pb.NewSummary(name, "", nil, nil, 0)
+	}
+	return err
+}
+
+func TestNameTakenByAnotherType(t *testing.T) {
+	tests := []struct {
+		taken, kind string
+	}{
+		{"gauge", "histogram"},
+		{"gauge", "summary"},
+		{"histogram", "counter"},
+		{"counter", "gauge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			pb := NewPrometheusBackend()
+			if err := create(pb, tt.taken, "taken"); err != nil {
+				t.Fatal(err)
+			}
+			if err := create(pb, tt.kind, "taken"); !errors.Is(err, metricsInterface.ErrMetricAlreadyRegistered) {
+				t.Errorf("%s over a %s: got %v, want ErrMetricAlreadyRegistered", tt.kind, tt.taken, err)
+			}
+		})
+	}
+}
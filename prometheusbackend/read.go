@@ -0,0 +1,80 @@
+package prometheusbackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// collectSamples reads the current series of a metric vector. Constant labels
+// are left out so the samples carry the same labels the caller writes with.
+func collectSamples(c prometheus.Collector, labelNames []string) ([]metricsInterface.Sample, error) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	wanted := make(map[string]bool, len(labelNames))
+	for _, name := range labelNames {
+		wanted[name] = true
+	}
+
+	var samples []metricsInterface.Sample
+	var err error
+	for m := range ch {
+		var pb dto.Metric
+		if werr := m.Write(&pb); werr != nil {
+			err = fmt.Errorf("failed to read series: %w", werr)
+			continue
+		}
+
+		sample := metricsInterface.Sample{Labels: make(map[string]string, len(labelNames))}
+		for _, pair := range pb.GetLabel() {
+			if wanted[pair.GetName()] {
+				sample.Labels[pair.GetName()] = pair.GetValue()
+			}
+		}
+		switch {
+		case pb.Counter != nil:
+			sample.Value = pb.Counter.GetValue()
+		case pb.Gauge != nil:
+			sample.Value = pb.Gauge.GetValue()
+		case pb.Histogram != nil:
+			sample.Count, sample.Sum = pb.Histogram.GetSampleCount(), pb.Histogram.GetSampleSum()
+		case pb.Summary != nil:
+			sample.Count, sample.Sum = pb.Summary.GetSampleCount(), pb.Summary.GetSampleSum()
+		}
+		samples = append(samples, sample)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return metricsInterface.SeriesKey(samples[i].Labels) < metricsInterface.SeriesKey(samples[j].Labels)
+	})
+	return samples, nil
+}
+
+// findSample returns the series of c with exactly labels.
+func findSample(c prometheus.Collector, labelNames []string, labels map[string]string) (metricsInterface.Sample, error) {
+	if err := metricsInterface.CheckLabels(labelNames, labels); err != nil {
+		return metricsInterface.Sample{}, err
+	}
+
+	samples, err := collectSamples(c, labelNames)
+	if err != nil {
+		return metricsInterface.Sample{}, err
+	}
+	key := metricsInterface.SeriesKey(labels)
+	for _, sample := range samples {
+		if metricsInterface.SeriesKey(sample.Labels) == key {
+			return sample, nil
+		}
+	}
+	return metricsInterface.Sample{}, metricsInterface.ErrSeriesNotFound
+}
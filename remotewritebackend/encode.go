@@ -0,0 +1,117 @@
+package remotewritebackend
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// label and timeSeries mirror the prometheus.Label and prometheus.TimeSeries
+// messages of the remote-write 1.0 protocol; each series has one sample.
+type label struct {
+	name, value string
+}
+
+type timeSeries struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// toTimeSeries flattens gathered metric families into remote-write series
+// the way a Prometheus scrape would: histograms become _bucket, _sum and
+// _count series, summaries quantile, _sum and _count series.
+func toTimeSeries(families []*dto.MetricFamily, timestamp int64) []timeSeries {
+	var series []timeSeries
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			add := func(suffix string, value float64, extra ...label) {
+				series = append(series, timeSeries{
+					labels:    seriesLabels(name+suffix, m.GetLabel(), extra...),
+					value:     value,
+					timestamp: timestamp,
+				})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				add("_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+// seriesLabels returns __name__ plus the metric labels, sorted by name as
+// remote-write receivers require.
+func seriesLabels(name string, pairs []*dto.LabelPair, extra ...label) []label {
+	labels := make([]label, 0, len(pairs)+len(extra)+1)
+	labels = append(labels, label{"__name__", name})
+	for _, p := range pairs {
+		labels = append(labels, label{p.GetName(), p.GetValue()})
+	}
+	labels = append(labels, extra...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// marshalWriteRequest encodes a prometheus.WriteRequest holding series.
+func marshalWriteRequest(series []timeSeries) []byte {
+	var buf []byte
+	for _, ts := range series {
+		var tsBuf []byte
+		for _, l := range ts.labels {
+			var lBuf []byte
+			lBuf = protowire.AppendTag(lBuf, 1, protowire.BytesType)
+			lBuf = protowire.AppendString(lBuf, l.name)
+			lBuf = protowire.AppendTag(lBuf, 2, protowire.BytesType)
+			lBuf = protowire.AppendString(lBuf, l.value)
+
+			tsBuf = protowire.AppendTag(tsBuf, 1, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, lBuf)
+		}
+
+		var sBuf []byte
+		sBuf = protowire.AppendTag(sBuf, 1, protowire.Fixed64Type)
+		sBuf = protowire.AppendFixed64(sBuf, math.Float64bits(ts.value))
+		sBuf = protowire.AppendTag(sBuf, 2, protowire.VarintType)
+		sBuf = protowire.AppendVarint(sBuf, uint64(ts.timestamp))
+
+		tsBuf = protowire.AppendTag(tsBuf, 2, protowire.BytesType)
+		tsBuf = protowire.AppendBytes(tsBuf, sBuf)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, tsBuf)
+	}
+	return buf
+}
@@ -0,0 +1,175 @@
+package remotewritebackend
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeWriteRequest parses a prometheus.WriteRequest back into timeSeries.
+func decodeWriteRequest(b []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return fmt.Errorf("unexpected WriteRequest field %d", num)
+		}
+		var ts timeSeries
+		err := eachField(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+			switch num {
+			case 1:
+				var l label
+				err := eachField(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+					if num == 1 {
+						l.name = string(v)
+					} else {
+						l.value = string(v)
+					}
+					return nil
+				})
+				ts.labels = append(ts.labels, l)
+				return err
+			case 2:
+				return eachField(v, func(num protowire.Number, typ protowire.Type, _ []byte, n uint64) error {
+					switch {
+					case num == 1 && typ == protowire.Fixed64Type:
+						ts.value = math.Float64frombits(n)
+					case num == 2 && typ == protowire.VarintType:
+						ts.timestamp = int64(n)
+					default:
+						return fmt.Errorf("unexpected Sample field %d", num)
+					}
+					return nil
+				})
+			}
+			return fmt.Errorf("unexpected TimeSeries field %d", num)
+		})
+		series = append(series, ts)
+		return err
+	})
+	return series, err
+}
+
+// eachField calls fn for every field of b with the payload of
+// length-delimited fields or the number of the others.
+func eachField(b []byte, fn func(protowire.Number, protowire.Type, []byte, uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			return fmt.Errorf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+}
+
+func TestToTimeSeries(t *testing.T) {
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("registrations"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label:   []*dto.LabelPair{labelPair("nf_type", "AMF"), labelPair("NetworkSlice", "slice1")},
+				Counter: &dto.Counter{Value: proto.Float64(3)},
+			}},
+		},
+		{
+			Name: proto.String("setup_time"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(3),
+					SampleSum:   proto.Float64(2.5),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(1)},
+						{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(2)},
+					},
+				},
+			}},
+		},
+		{
+			Name: proto.String("latency"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(4),
+					SampleSum:   proto.Float64(8),
+					Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.99), Value: proto.Float64(3)}},
+				},
+			}},
+		},
+	}
+
+	ts := func(value float64, labels ...string) timeSeries {
+		s := timeSeries{value: value, timestamp: 1000}
+		for i := 0; i < len(labels); i += 2 {
+			s.labels = append(s.labels, label{labels[i], labels[i+1]})
+		}
+		return s
+	}
+	want := []timeSeries{
+		// Labels sorted by name, with upper case before __name__
+		ts(3, "NetworkSlice", "slice1", "__name__", "registrations", "nf_type", "AMF"),
+		ts(1, "__name__", "setup_time_bucket", "le", "0.5"),
+		ts(2, "__name__", "setup_time_bucket", "le", "1"),
+		ts(3, "__name__", "setup_time_bucket", "le", "+Inf"),
+		ts(2.5, "__name__", "setup_time_sum"),
+		ts(3, "__name__", "setup_time_count"),
+		ts(3, "__name__", "latency", "quantile", "0.99"),
+		ts(8, "__name__", "latency_sum"),
+		ts(4, "__name__", "latency_count"),
+	}
+
+	got := toTimeSeries(families, 1000)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toTimeSeries() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestMarshalWriteRequest(t *testing.T) {
+	series := []timeSeries{
+		{labels: []label{{"__name__", "registrations"}, {"nf_type", "AMF"}}, value: 3, timestamp: 1700000000000},
+		{labels: []label{{"__name__", "cpu_load"}}, value: -0.25, timestamp: 1700000000001},
+		{labels: []label{{"__name__", "empty"}, {"cause", ""}}, value: math.Inf(1), timestamp: 0},
+	}
+
+	got, err := decodeWriteRequest(marshalWriteRequest(series))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, series) {
+		t.Errorf("decoded %v, want %v", got, series)
+	}
+
+	if b := marshalWriteRequest(nil); len(b) != 0 {
+		t.Errorf("empty WriteRequest encoded as %x", b)
+	}
+}
@@ -0,0 +1,129 @@
+package remotewritebackend
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/prometheusbackend"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultInterval   = 15 * time.Second
+	DefaultTimeout    = 30 * time.Second
+	DefaultBatchSize  = 2000
+	DefaultQueueSize  = 100
+	DefaultMaxRetries = 10
+	DefaultMinBackoff = 30 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// Config describes the remote-write receiver (Prometheus, Mimir,
+// VictoriaMetrics, ...). BatchSize is the number of series per request and
+// QueueSize the number of requests waiting to be sent. MaxRetries is the
+// number of retries of a failed request: 0 disables retries and a negative
+// value takes DefaultMaxRetries. Other zero values take the defaults. Set
+// either Username/Password or BearerToken.
+type Config struct {
+	URL         string
+	Interval    time.Duration
+	Timeout     time.Duration
+	BatchSize   int
+	QueueSize   int
+	MaxRetries  int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	Username    string
+	Password    string
+	BearerToken string
+	Headers     map[string]string
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = DefaultMinBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	return c
+}
+
+// RemoteWriteBackend keeps its metrics in a Prometheus registry, exactly like
+// the Prometheus backend, and sends the registry to a remote-write receiver
+// instead of waiting to be scraped or pushing to a Pushgateway.
+type RemoteWriteBackend struct {
+	prom *prometheusbackend.PrometheusBackend
+	w    *writer
+}
+
+func NewRemoteWriteBackend(cfg Config) (*RemoteWriteBackend, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("remote-write URL is required")
+	}
+	if cfg.BearerToken != "" && cfg.Username != "" {
+		return nil, errors.New("remote write takes basic auth or a bearer token, not both")
+	}
+
+	prom := prometheusbackend.NewPrometheusBackend()
+	return &RemoteWriteBackend{
+		prom: prom,
+		w:    newWriter(cfg.withDefaults(), prom.Gatherer()),
+	}, nil
+}
+
+func (rb *RemoteWriteBackend) WithConstLabels(labels map[string]string) metricsInterface.Backend {
+	return &RemoteWriteBackend{
+		prom: rb.prom.WithConstLabels(labels).(*prometheusbackend.PrometheusBackend),
+		w:    rb.w,
+	}
+}
+
+func (rb *RemoteWriteBackend) NewCounter(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return rb.prom.NewCounter(name, help, labels)
+}
+
+func (rb *RemoteWriteBackend) NewGauge(name, help string, labels []string) (metricsInterface.Metric, error) {
+	return rb.prom.NewGauge(name, help, labels)
+}
+
+func (rb *RemoteWriteBackend) NewHistogram(name, help string, labels []string, buckets []float64) (metricsInterface.Metric, error) {
+	return rb.prom.NewHistogram(name, help, labels, buckets)
+}
+
+func (rb *RemoteWriteBackend) NewSummary(name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (metricsInterface.Metric, error) {
+	return rb.prom.NewSummary(name, help, labels, objectives, maxAge)
+}
+
+// Handler serves the registry for local inspection; the receiver gets it by
+// remote write.
+func (rb *RemoteWriteBackend) Handler() http.Handler {
+	return rb.prom.Handler()
+}
+
+// PushToGateway writes the current values now instead of waiting for the
+// next interval; the gateway URL and job name are not used.
+func (rb *RemoteWriteBackend) PushToGateway(gatewayURL, jobName string) error {
+	return rb.w.flush()
+}
+
+// Close sends a final write, waiting at most Timeout for it, and stops the
+// background loops.
+func (rb *RemoteWriteBackend) Close() error {
+	return rb.w.close()
+}
@@ -0,0 +1,234 @@
+package remotewritebackend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ErrQueueFull = errors.New("remote-write queue full")
+
+// request is one compressed WriteRequest. done is set for writes someone
+// waits for (PushToGateway) and receives the outcome.
+type request struct {
+	body   []byte
+	series int
+	done   chan error
+}
+
+// writer gathers the registry on an interval and sends the batches from a
+// bounded queue, one request at a time so samples arrive in order. When the
+// queue is full the oldest request is dropped: the values are cumulative, so
+// a later request supersedes it.
+type writer struct {
+	cfg      Config
+	client   *http.Client
+	gatherer prometheus.Gatherer
+	pending  chan *request
+	stop     chan struct{}
+	ctx      context.Context // cancelled on stop, aborting a request in flight
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+func newWriter(cfg Config, gatherer prometheus.Gatherer) *writer {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &writer{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		gatherer: gatherer,
+		pending:  make(chan *request, cfg.QueueSize),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	w.wg.Add(2)
+	go w.collectLoop()
+	go w.sendLoop()
+	return w
+}
+
+func (w *writer) collectLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			for _, r := range w.collect(false) {
+				w.enqueue(r)
+			}
+		}
+	}
+}
+
+func (w *writer) sendLoop() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case r := <-w.pending:
+			err := w.send(r)
+			if err != nil {
+				log.Printf("Remote write of %d series failed: %v", r.series, err)
+			}
+			if r.done != nil {
+				r.done <- err
+			}
+		}
+	}
+}
+
+// collect gathers the registry into requests of at most BatchSize series,
+// all stamped with the same time.
+func (w *writer) collect(wait bool) []*request {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		log.Printf("Remote write gathered metrics with errors: %v", err)
+	}
+
+	series := toTimeSeries(families, time.Now().UnixMilli())
+	var requests []*request
+	for start := 0; start < len(series); start += w.cfg.BatchSize {
+		batch := series[start:min(start+w.cfg.BatchSize, len(series))]
+		r := &request{
+			body:   snappy.Encode(nil, marshalWriteRequest(batch)),
+			series: len(batch),
+		}
+		if wait {
+			r.done = make(chan error, 1)
+		}
+		requests = append(requests, r)
+	}
+	return requests
+}
+
+func (w *writer) enqueue(r *request) {
+	for {
+		select {
+		case w.pending <- r:
+			return
+		default:
+		}
+
+		select {
+		case old := <-w.pending:
+			log.Printf("Remote-write queue full, dropping %d series", old.series)
+			if old.done != nil {
+				old.done <- ErrQueueFull
+			}
+		default:
+		}
+	}
+}
+
+// flush sends the current values now and waits for the outcome.
+func (w *writer) flush() error {
+	requests := w.collect(true)
+	for _, r := range requests {
+		w.enqueue(r)
+	}
+
+	var errs []error
+	for _, r := range requests {
+		select {
+		case err := <-r.done:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-w.stop:
+			return errors.New("remote-write backend closed")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send posts one request, retrying with exponential backoff on network
+// errors, 429 and 5xx responses. Other responses are not retried.
+func (w *writer) send(r *request) error {
+	backoff := w.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(r.body)
+		if err == nil || !retry || attempt >= w.cfg.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-w.stop:
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, w.cfg.MaxBackoff)
+	}
+}
+
+func (w *writer) post(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case w.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+w.cfg.BearerToken)
+	case w.cfg.Username != "":
+		req.SetBasicAuth(w.cfg.Username, w.cfg.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	err = fmt.Errorf("remote write returned %s", resp.Status)
+	if msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256)); len(bytes.TrimSpace(msg)) > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(msg))
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// close sends a final write and stops the loops. The final write gets at
+// most Timeout, retries included, so a receiver that is down does not hold
+// up shutdown for the whole backoff schedule.
+func (w *writer) close() error {
+	flushed := make(chan error, 1)
+	go func() { flushed <- w.flush() }()
+
+	var err error
+	select {
+	case err = <-flushed:
+	case <-time.After(w.cfg.Timeout):
+		err = fmt.Errorf("final remote write did not complete within %s", w.cfg.Timeout)
+	}
+	w.once.Do(func() {
+		close(w.stop)
+		w.cancel()
+	})
+	w.wg.Wait()
+	return err
+}
@@ -0,0 +1,217 @@
+package remotewritebackend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// receiver is a remote-write endpoint answering with the queued status
+// codes, then 204, and keeping the series of the last accepted request.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	attempts int
+	header   http.Header
+	series   []timeSeries
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.attempts++
+		r.header = req.Header.Clone()
+		if len(r.statuses) > 0 {
+			status := r.statuses[0]
+			r.statuses = r.statuses[1:]
+			http.Error(w, "rejected", status)
+			return
+		}
+
+		compressed, _ := io.ReadAll(req.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.series, err = decodeWriteRequest(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *receiver) result() (int, http.Header, []timeSeries) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts, r.header, r.series
+}
+
+func newTestBackend(t *testing.T, cfg Config) *RemoteWriteBackend {
+	t.Helper()
+
+	cfg.Interval = time.Hour
+	cfg.MinBackoff = time.Millisecond
+	rb, err := NewRemoteWriteBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rb.Close() })
+
+	counter, err := rb.NewCounter("registrations", "Registrations", []string{"NetworkSlice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(3, map[string]string{"NetworkSlice": "slice1"})
+	return rb
+}
+
+func TestPush(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	rb := newTestBackend(t, Config{URL: srv.URL, Username: "site1", Password: "secret", Headers: map[string]string{"X-Scope-OrgID": "tenant1"}})
+
+	if err := rb.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts, header, series := rcv.result()
+	if attempts != 1 {
+		t.Errorf("got %d requests, want 1", attempts)
+	}
+	if header.Get("Content-Encoding") != "snappy" || header.Get("Content-Type") != "application/x-protobuf" ||
+		header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("request headers %v", header)
+	}
+	if header.Get("X-Scope-OrgID") != "tenant1" {
+		t.Errorf("X-Scope-OrgID = %q, want tenant1", header.Get("X-Scope-OrgID"))
+	}
+	req := http.Request{Header: header}
+	if user, pass, ok := req.BasicAuth(); !ok || user != "site1" || pass != "secret" {
+		t.Errorf("basic auth %q/%q, want site1/secret", user, pass)
+	}
+
+	if len(series) != 1 || series[0].value != 3 {
+		t.Fatalf("received %v, want the registrations series", series)
+	}
+	want := []label{{"NetworkSlice", "slice1"}, {"__name__", "registrations"}}
+	if got := series[0].labels; !slices.Equal(got, want) {
+		t.Errorf("labels %v, want %v", got, want)
+	}
+}
+
+func TestPushBearerToken(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	rb := newTestBackend(t, Config{URL: srv.URL, BearerToken: "token1"})
+
+	if err := rb.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, header, _ := rcv.result(); header.Get("Authorization") != "Bearer token1" {
+		t.Errorf("Authorization = %q, want the bearer token", header.Get("Authorization"))
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantAttempts int
+		wantErr      string
+	}{
+		{"retried after 503", []int{503}, 2, 2, ""},
+		{"retried after 429", []int{429, 429}, 2, 3, ""},
+		{"retries exhausted", []int{503, 503, 503}, 2, 3, "503 Service Unavailable: rejected"},
+		{"zero disables retries", []int{503}, 0, 1, "503 Service Unavailable"},
+		{"4xx not retried", []int{400}, 2, 1, "400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv, srv := newReceiver(t, tt.statuses...)
+			rb := newTestBackend(t, Config{URL: srv.URL, MaxRetries: tt.maxRetries})
+
+			err := rb.PushToGateway("", "")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("PushToGateway() = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("PushToGateway() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if attempts, _, _ := rcv.result(); attempts != tt.wantAttempts {
+				t.Errorf("got %d requests, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	rcv, srv := newReceiver(t)
+	rb := newTestBackend(t, Config{URL: srv.URL, BatchSize: 2})
+	gauge, err := rb.NewGauge("cpu_load", "CPU load", []string{"core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, core := range []string{"0", "1"} {
+		gauge.Set(0.5, map[string]string{"core": core})
+	}
+
+	if err := rb.PushToGateway("", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Three series in batches of two
+	if attempts, _, series := rcv.result(); attempts != 2 || len(series) != 1 {
+		t.Errorf("got %d requests, the last with %d series, want 2 and 1", attempts, len(series))
+	}
+}
+
+func TestCloseDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	rb, err := NewRemoteWriteBackend(Config{URL: srv.URL, Interval: time.Hour, Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := rb.NewCounter("registrations", "Registrations", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Inc(nil)
+
+	start := time.Now()
+	err = rb.Close()
+	if err == nil {
+		t.Error("Close() succeeded against a receiver that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close() took %s with a 50ms timeout", elapsed)
+	}
+}
+
+func TestNewRemoteWriteBackendErrors(t *testing.T) {
+	if _, err := NewRemoteWriteBackend(Config{}); err == nil {
+		t.Error("accepted a config without a URL")
+	}
+	if _, err := NewRemoteWriteBackend(Config{URL: "http://localhost", Username: "a", BearerToken: "b"}); err == nil {
+		t.Error("accepted both basic auth and a bearer token")
+	}
+}
@@ -1,19 +1,28 @@
 package service
 
 import (
+	"amantya_metrics/metricsInterface"
 	"amantya_metrics/metrics_wrapper"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 )
 
 type MetricRequest struct {
 	Name   string            `json:"name"`
 	Value  float64           `json:"value,omitempty"`
 	Labels map[string]string `json:"labels,omitempty"`
+	// Partial selects partial-match deletion on the series route.
+	Partial bool `json:"partial,omitempty"`
 }
 
+// MetricsPath is where the scrape endpoint is served.
+const MetricsPath = "/metrics"
+
 type APIHandler struct {
 	framework *metrics_wrapper.MetricsFramework
 }
@@ -22,14 +31,22 @@ func NewAPIHandler(framework *metrics_wrapper.MetricsFramework) *APIHandler {
 	return &APIHandler{framework: framework}
 }
 
-// Consistent normalization function used everywhere
-func normalizeMetricName(displayName string) string {
-	name := strings.ToLower(displayName)
-	name = strings.ReplaceAll(name, " ", "_")
-	name = strings.ReplaceAll(name, "-", "_")
-	name = strings.ReplaceAll(name, "(", "")
-	name = strings.ReplaceAll(name, ")", "")
-	return name
+// decodeMetricRequest reads the JSON body. On the versioned routes the metric
+// name comes from the {name} path segment and overrides any name in the body.
+func decodeMetricRequest(r *http.Request) (MetricRequest, error) {
+	var req MetricRequest
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, err
+		}
+	}
+	if name := r.PathValue("name"); name != "" {
+		req.Name = name
+	}
+	if req.Name == "" {
+		return req, errors.New("metric name is required")
+	}
+	return req, nil
 }
 
 func (h *APIHandler) RegisterMetrics(w http.ResponseWriter, r *http.Request) {
@@ -42,133 +59,165 @@ func (h *APIHandler) RegisterMetrics(w http.ResponseWriter, r *http.Request) {
 
 	// Register fresh metrics
 	if err := h.framework.RegisterMetrics(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeSuccess(w)
 }
 
 func (h *APIHandler) IncrementMetric(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name   string            `json:"name"`
-		Labels map[string]string `json:"labels"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	req, err := decodeMetricRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	metricName := normalizeMetricName(req.Name)
+	metricName := req.Name
 	log.Printf("Attempting to increment metric: %s", metricName)
 
-	metric, err := h.framework.GetMetric(metricName)
-	if err != nil {
-		log.Printf("Metric not found: %s (searched as: %s)", req.Name, metricName)
-		http.Error(w, "metric not found: "+metricName, http.StatusNotFound)
-		return
-	}
-
-	if err := metric.Inc(req.Labels); err != nil {
+	if err := h.framework.IncrementMetric(metricName, req.Labels); err != nil {
 		log.Printf("Increment failed for %s: %v", metricName, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
 		return
 	}
 
 	log.Printf("Successfully incremented metric: %s", metricName)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeSuccess(w)
 }
 
 func (h *APIHandler) DecrementMetric(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name   string            `json:"name"`
-		Labels map[string]string `json:"labels"`
+	req, err := decodeMetricRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	metricName := req.Name
+	log.Printf("Decrementing metric: %s", metricName)
+
+	if err := h.framework.DecrementMetric(metricName, req.Labels); err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
 		return
 	}
 
-	metricName := normalizeMetricName(req.Name)
-	log.Printf("Decrementing metric: %s", metricName)
+	writeSuccess(w)
+}
 
-	metric, err := h.framework.GetMetric(metricName)
+func (h *APIHandler) AddToMetric(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeMetricRequest(r)
 	if err != nil {
-		http.Error(w, "metric not found: "+metricName, http.StatusNotFound)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := metric.Dec(req.Labels); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	metricName := req.Name
+	log.Printf("Adding to metric: %s", metricName)
+
+	if err := h.framework.AddToMetric(metricName, req.Value, req.Labels); err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeSuccess(w)
 }
 
-func (h *APIHandler) AddToMetric(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name   string            `json:"name"`
-		Value  float64           `json:"value"`
-		Labels map[string]string `json:"labels"`
+func (h *APIHandler) SetMetric(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeMetricRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	metricName := req.Name
+	log.Printf("Setting metric: %s", metricName)
+
+	if err := h.framework.SetMetric(metricName, req.Value, req.Labels); err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
 		return
 	}
 
-	metricName := normalizeMetricName(req.Name)
-	log.Printf("Adding to metric: %s", metricName)
+	writeSuccess(w)
+}
 
-	metric, err := h.framework.GetMetric(metricName)
+func (h *APIHandler) ObserveMetric(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeMetricRequest(r)
 	if err != nil {
-		http.Error(w, "metric not found: "+metricName, http.StatusNotFound)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := metric.Add(req.Value, req.Labels); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	metricName := req.Name
+	log.Printf("Observing metric: %s", metricName)
+
+	if err := h.framework.ObserveMetric(metricName, req.Value, req.Labels); err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeSuccess(w)
 }
 
-func (h *APIHandler) SetMetric(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name   string            `json:"name"`
-		Value  float64           `json:"value"`
-		Labels map[string]string `json:"labels"`
+// GetMetricValue returns the current series of a metric. Query parameters
+// filter the series by label, e.g. ?NetworkSlice=1-000001.
+func (h *APIHandler) GetMetricValue(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	metric, err := h.framework.GetMetric(name)
+	if err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", name, err))
+		return
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	samples, err := h.framework.GetMetricSeries(name)
+	if err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", name, err))
 		return
 	}
 
-	metricName := normalizeMetricName(req.Name)
-	log.Printf("Setting metric: %s", metricName)
+	filter := make(map[string]string)
+	for label, values := range r.URL.Query() {
+		filter[label] = values[0]
+	}
+	series := make([]metricsInterface.Sample, 0, len(samples))
+	for _, sample := range samples {
+		if metricsInterface.MatchesLabels(sample.Labels, filter) {
+			series = append(series, sample)
+		}
+	}
 
-	metric, err := h.framework.GetMetric(metricName)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metric": name,
+		"type":   metric.GetMetricType(),
+		"series": series,
+	})
+}
+
+// DeleteSeries removes the series with exactly the given labels or, with
+// "partial": true, every series whose labels include them.
+func (h *APIHandler) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeMetricRequest(r)
 	if err != nil {
-		http.Error(w, "metric not found: "+metricName, http.StatusNotFound)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	metricName := req.Name
+	if req.Partial {
+		deleted, err := h.framework.DeletePartialMatch(metricName, req.Labels)
+		if err != nil {
+			writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
+			return
+		}
+		log.Printf("Deleted %d series of %s", deleted, metricName)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "deleted": deleted})
 		return
 	}
 
-	if err := metric.Set(req.Value, req.Labels); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.framework.DeleteSeries(metricName, req.Labels); err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", metricName, err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "deleted": 1})
 }
 
 func (h *APIHandler) PushMetrics(w http.ResponseWriter, r *http.Request) {
@@ -178,39 +227,145 @@ func (h *APIHandler) PushMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := h.framework.PushMetrics(req.GatewayURL, req.JobName); err != nil {
 		log.Printf("Push to gateway failed: %v", err)
-		w.WriteHeader(http.StatusAccepted)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":  "accepted",
-			"message": "Metrics collected but push failed",
-		})
+		status := statusFor(err)
+		if status == http.StatusInternalServerError {
+			// Not a framework error, so the gateway or the way to it failed
+			status = http.StatusBadGateway
+		}
+		writeError(w, status, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeSuccess(w)
+}
+
+// ScrapeMetrics serves the backend's current metrics in the Prometheus
+// exposition (or OpenMetrics) format.
+func (h *APIHandler) ScrapeMetrics(w http.ResponseWriter, r *http.Request) {
+	h.framework.Handler().ServeHTTP(w, r)
+}
+
+// RegisterScrapeRoute mounts ScrapeMetrics on MetricsPath.
+func (h *APIHandler) RegisterScrapeRoute(mux *http.ServeMux) {
+	mux.HandleFunc(MetricsPath, h.ScrapeMetrics)
 }
 
 func (h *APIHandler) ListMetrics(w http.ResponseWriter, r *http.Request) {
 	metrics := h.framework.ListMetrics()
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"metrics": metrics,
 		"count":   len(metrics),
 	})
 }
 
+// Cardinality reports the distinct series, limit and overflow counters of the
+// metric named in the path.
+func (h *APIHandler) Cardinality(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	stats, err := h.framework.Cardinality(name)
+	if err != nil {
+		writeError(w, statusFor(err), fmt.Errorf("%s: %w", name, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// CardinalityReport lists Cardinality for every registered metric.
+func (h *APIHandler) CardinalityReport(w http.ResponseWriter, r *http.Request) {
+	report := h.framework.CardinalityReport()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metrics": report,
+		"count":   len(report),
+	})
+}
+
+// PMJobRequest starts a PM job; Granularity is a duration such as "15m".
+type PMJobRequest struct {
+	ID          string `json:"id,omitempty"`
+	Granularity string `json:"granularity"`
+	Retention   int    `json:"retention,omitempty"`
+}
+
+func (h *APIHandler) ListPMJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.framework.PMJobs())
+}
+
+func (h *APIHandler) StartPMJob(w http.ResponseWriter, r *http.Request) {
+	var req PMJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	granularity, err := time.ParseDuration(req.Granularity)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid granularity: %w", err))
+		return
+	}
+
+	cfg := metrics_wrapper.PMJobConfig{ID: req.ID, Granularity: granularity, Retention: req.Retention}
+	if err := h.framework.StartPMJob(cfg); err != nil {
+		status := statusFor(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeSuccess(w)
+}
+
+func (h *APIHandler) StopPMJob(w http.ResponseWriter, r *http.Request) {
+	if err := h.framework.StopPMJob(r.PathValue("id")); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeSuccess(w)
+}
+
+// PMReports returns the kept period reports of a job, oldest first. ?last=N
+// limits the answer to the N most recent.
+func (h *APIHandler) PMReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := h.framework.PMReports(r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	if last := r.URL.Query().Get("last"); last != "" {
+		n, err := strconv.Atoi(last)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid last=%q", last))
+			return
+		}
+		if n < len(reports) {
+			reports = reports[len(reports)-n:]
+		}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// ClosePMPeriod ends the current period of a job now and returns its report.
+func (h *APIHandler) ClosePMPeriod(w http.ResponseWriter, r *http.Request) {
+	report, err := h.framework.ClosePMPeriod(r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				log.Printf("panic: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, errors.New("internal server error"))
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -230,12 +385,22 @@ func (h *APIHandler) DebugMetrics(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		series, err := metric.Series()
+		if err != nil {
+			details[name] = map[string]interface{}{
+				"type":   metric.GetMetricType(),
+				"status": "error",
+				"error":  err.Error(),
+			}
+			continue
+		}
+
 		details[name] = map[string]interface{}{
 			"type":   metric.GetMetricType(),
 			"status": "ok",
+			"series": series,
 		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(details)
+	writeJSON(w, http.StatusOK, details)
 }
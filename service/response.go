@@ -0,0 +1,54 @@
+package service
+
+import (
+	"amantya_metrics/metricsInterface"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+type errorResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeSuccess(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Status: "error", Error: err.Error()})
+}
+
+// statusFor maps framework errors onto HTTP status codes.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, metricsInterface.ErrMetricNotFound),
+		errors.Is(err, metricsInterface.ErrSeriesNotFound),
+		errors.Is(err, metricsInterface.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, metricsInterface.ErrInvalidOperation),
+		errors.Is(err, metricsInterface.ErrInvalidLabel):
+		return http.StatusBadRequest
+	case errors.Is(err, metricsInterface.ErrOperationNotPermitted):
+		return http.StatusForbidden
+	case errors.Is(err, metricsInterface.ErrCardinalityExceeded):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, metricsInterface.ErrMetricAlreadyRegistered),
+		errors.Is(err, metricsInterface.ErrJobExists):
+		return http.StatusConflict
+	case errors.Is(err, metricsInterface.ErrBackendNotSupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"amantya_metrics/metrics_wrapper"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config controls the HTTP server built by NewServer. Zero values fall back
+// to the defaults below.
+type Config struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+const (
+	DefaultAddr            = ":8080"
+	DefaultReadTimeout     = 10 * time.Second
+	DefaultWriteTimeout    = 10 * time.Second
+	DefaultIdleTimeout     = 60 * time.Second
+	DefaultShutdownTimeout = 15 * time.Second
+)
+
+func (c Config) withDefaults() Config {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = DefaultReadTimeout
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = DefaultWriteTimeout
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = DefaultIdleTimeout
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	return c
+}
+
+type Server struct {
+	handler *APIHandler
+	server  *http.Server
+	cfg     Config
+}
+
+func NewServer(framework *metrics_wrapper.MetricsFramework, cfg Config) *Server {
+	cfg = cfg.withDefaults()
+	s := &Server{
+		handler: NewAPIHandler(framework),
+		cfg:     cfg,
+	}
+	s.server = &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      RecoveryMiddleware(s.Routes()),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	return s
+}
+
+// Routes builds the REST API mux. Each path is registered once and dispatches
+// on the method itself, so a wrong method gets a JSON 405 instead of the mux's
+// plain-text one. Everything under /v1/metrics/ is keyed by KPI name, so the
+// fixed endpoints live outside it and no KPI name is shadowed.
+func (s *Server) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	h := s.handler
+
+	routes := []struct {
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{http.MethodGet, "/healthz", s.health},
+		{http.MethodGet, MetricsPath, h.ScrapeMetrics},
+		{http.MethodGet, "/v1/metrics", h.ListMetrics},
+		{http.MethodPost, "/v1/register", h.RegisterMetrics},
+		{http.MethodGet, "/v1/debug/metrics", h.DebugMetrics},
+		{http.MethodGet, "/v1/metrics/{name}", h.GetMetricValue},
+		{http.MethodPost, "/v1/metrics/{name}/inc", h.IncrementMetric},
+		{http.MethodPost, "/v1/metrics/{name}/dec", h.DecrementMetric},
+		{http.MethodPost, "/v1/metrics/{name}/add", h.AddToMetric},
+		{http.MethodPost, "/v1/metrics/{name}/set", h.SetMetric},
+		{http.MethodPost, "/v1/metrics/{name}/observe", h.ObserveMetric},
+		{http.MethodDelete, "/v1/metrics/{name}/series", h.DeleteSeries},
+		{http.MethodGet, "/v1/metrics/{name}/cardinality", h.Cardinality},
+		{http.MethodGet, "/v1/cardinality", h.CardinalityReport},
+		{http.MethodPost, "/v1/push", h.PushMetrics},
+		{http.MethodGet, "/v1/pm/jobs", h.ListPMJobs},
+		{http.MethodPost, "/v1/pm/jobs", h.StartPMJob},
+		{http.MethodDelete, "/v1/pm/jobs/{id}", h.StopPMJob},
+		{http.MethodGet, "/v1/pm/jobs/{id}/reports", h.PMReports},
+		{http.MethodPost, "/v1/pm/jobs/{id}/close", h.ClosePMPeriod},
+	}
+
+	byPath := make(map[string]map[string]http.HandlerFunc)
+	var paths []string
+	for _, rt := range routes {
+		if byPath[rt.path] == nil {
+			byPath[rt.path] = make(map[string]http.HandlerFunc)
+			paths = append(paths, rt.path)
+		}
+		byPath[rt.path][rt.method] = rt.handler
+	}
+	for _, path := range paths {
+		mux.HandleFunc(path, dispatch(byPath[path]))
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s %s", r.Method, r.URL.Path))
+	})
+
+	return mux
+}
+
+// dispatch picks the handler for the request method, serving HEAD like GET.
+func dispatch(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	methods := make([]string, 0, len(handlers))
+	for m := range handlers {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	allow := strings.Join(methods, ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if handler, ok := handlers[method]; ok {
+			handler(w, r)
+			return
+		}
+		w.Header().Set("Allow", allow)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed, use %s", r.Method, allow))
+	}
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+func (s *Server) ListenAndServe() error {
+	log.Printf("Metrics service listening on %s", s.cfg.Addr)
+	return s.server.ListenAndServe()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Run serves until ctx is cancelled, then drains in-flight requests for up to
+// ShutdownTimeout.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down metrics service")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
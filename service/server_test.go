@@ -0,0 +1,200 @@
+package service
+
+import (
+	"amantya_metrics/metricsInterface"
+	"amantya_metrics/metrics_wrapper"
+	"amantya_metrics/metricstest"
+	"amantya_metrics/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var registrations = models.KPI{
+	Name:           "Registrations",
+	DisplayName:    "registrations",
+	PrometheusType: "Counter",
+	Object:         []string{"Result"},
+	Increment:      true,
+}
+
+// call sends body to path and decodes the JSON response into out.
+func call(t *testing.T, srv *httptest.Server, method, path, body string, out any) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: Content-Type %q, want application/json", method, path, ct)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding the response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+func newTestServer(t *testing.T, fw *metrics_wrapper.MetricsFramework) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(NewServer(fw, Config{}).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRoutes(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, registrations)
+	srv := newTestServer(t, fw)
+
+	tests := []struct {
+		method, path, body string
+		want               int
+		wantErr            string
+	}{
+		{http.MethodGet, "/healthz", "", http.StatusOK, ""},
+		{http.MethodPost, "/v1/metrics/registrations/inc", `{"labels": {"Result": "Success"}}`, http.StatusOK, ""},
+		{http.MethodPost, "/v1/metrics/registrations/add", `{"value": 2, "labels": {"Result": "Success"}}`, http.StatusOK, ""},
+		{http.MethodPost, "/v1/metrics/registrations/dec", `{"labels": {"Result": "Success"}}`, http.StatusForbidden, "operation not permitted"},
+		{http.MethodPost, "/v1/metrics/registrations/inc", `{"labels": {"Cause": "x"}}`, http.StatusBadRequest, "missing Result"},
+		{http.MethodPost, "/v1/metrics/registrations/observe", `{"value": 1, "labels": {"Result": "Success"}}`, http.StatusBadRequest, "invalid operation"},
+		{http.MethodPost, "/v1/metrics/sessions/inc", `{}`, http.StatusNotFound, "metric not found"},
+		{http.MethodPost, "/v1/metrics/registrations/inc", `{"labels":`, http.StatusBadRequest, "unexpected EOF"},
+		{http.MethodPost, "/v1/pm/jobs/job1/close", "", http.StatusNotFound, "pm job not found"},
+		{http.MethodGet, "/v1/unknown", "", http.StatusNotFound, "no route for GET /v1/unknown"},
+	}
+	for _, tt := range tests {
+		var body map[string]any
+		resp := call(t, srv, tt.method, tt.path, tt.body, &body)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status %d, want %d (%v)", tt.method, tt.path, resp.StatusCode, tt.want, body)
+			continue
+		}
+		if tt.wantErr == "" {
+			continue
+		}
+		if msg, _ := body["error"].(string); body["status"] != "error" || !strings.Contains(msg, tt.wantErr) {
+			t.Errorf("%s %s: body %v, want an error containing %q", tt.method, tt.path, body, tt.wantErr)
+		}
+	}
+
+	var value struct {
+		Series []metricsInterface.Sample `json:"series"`
+	}
+	call(t, srv, http.MethodGet, "/v1/metrics/registrations?Result=Success", "", &value)
+	if len(value.Series) != 1 || value.Series[0].Value != 3 {
+		t.Errorf("GET /v1/metrics/registrations = %+v, want Result=Success at 3", value.Series)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t, registrations)
+	srv := newTestServer(t, fw)
+
+	tests := []struct {
+		method, path, allow string
+	}{
+		{http.MethodGet, "/v1/metrics/registrations/inc", "POST"},
+		{http.MethodPut, "/v1/pm/jobs", "GET, POST"},
+		{http.MethodPost, "/v1/metrics/registrations", "GET"},
+	}
+	for _, tt := range tests {
+		var body errorResponse
+		resp := call(t, srv, tt.method, tt.path, "", &body)
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != tt.allow {
+			t.Errorf("%s %s: status %d with Allow %q, want 405 with %q", tt.method, tt.path, resp.StatusCode, resp.Header.Get("Allow"), tt.allow)
+		}
+		if body.Status != "error" || !strings.Contains(body.Error, "method "+tt.method+" not allowed") {
+			t.Errorf("%s %s: body %+v", tt.method, tt.path, body)
+		}
+	}
+}
+
+// failingPush is a backend whose gateway cannot be reached.
+type failingPush struct {
+	*metricstest.Backend
+}
+
+func (failingPush) PushToGateway(gatewayURL, jobName string) error {
+	return errors.New("dial tcp: connection refused")
+}
+
+func TestPush(t *testing.T) {
+	fw, backend := metricstest.NewFramework(t, registrations)
+	srv := newTestServer(t, fw)
+	if resp := call(t, srv, http.MethodPost, "/v1/push", `{"gateway_url": "http://gateway", "job_name": "amf"}`, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("push: status %d, want 200", resp.StatusCode)
+	}
+	if backend.Pushes() != 1 {
+		t.Errorf("backend got %d pushes, want 1", backend.Pushes())
+	}
+
+	failing, err := metrics_wrapper.MetricsWithBackend(failingPush{metricstest.NewBackend()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { failing.Close() })
+	var body errorResponse
+	resp := call(t, newTestServer(t, failing), http.MethodPost, "/v1/push", `{"gateway_url": "http://gateway", "job_name": "amf"}`, &body)
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(body.Error, "connection refused") {
+		t.Errorf("failed push: status %d with %+v, want 502 with the gateway error", resp.StatusCode, body)
+	}
+}
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{metricsInterface.ErrMetricNotFound, http.StatusNotFound},
+		{metricsInterface.ErrSeriesNotFound, http.StatusNotFound},
+		{metricsInterface.ErrJobNotFound, http.StatusNotFound},
+		{metricsInterface.ErrInvalidOperation, http.StatusBadRequest},
+		{metricsInterface.ErrInvalidLabel, http.StatusBadRequest},
+		{metricsInterface.ErrOperationNotPermitted, http.StatusForbidden},
+		{metricsInterface.ErrCardinalityExceeded, http.StatusUnprocessableEntity},
+		{metricsInterface.ErrMetricAlreadyRegistered, http.StatusConflict},
+		{metricsInterface.ErrJobExists, http.StatusConflict},
+		{metricsInterface.ErrBackendNotSupported, http.StatusNotImplemented},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		// Wrapped the way the framework returns them
+		if got := statusFor(fmt.Errorf("metric error: set on m: %w", tt.err)); got != tt.want {
+			t.Errorf("statusFor(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRunShutsDownOnCancel(t *testing.T) {
+	fw, _ := metricstest.NewFramework(t)
+	s := NewServer(fw, Config{Addr: "127.0.0.1:0", ShutdownTimeout: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v after cancel, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"amantya_metrics/otlpbackend"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Exports a counter and a histogram through the OTLP backend to an in-process
+// HTTP receiver that stands in for the OpenTelemetry Collector, and prints
+// the metrics it receives.
+func main() {
+	received := make(chan *colmetricpb.ExportMetricsServiceRequest, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req := &colmetricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- req
+
+		resp, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+	defer receiver.Close()
+
+	backend, err := otlpbackend.NewOTLPBackend(otlpbackend.Config{
+		Endpoint:  receiver.URL,
+		Protocol:  otlpbackend.ProtocolHTTP,
+		Interval:  time.Hour, // export on PushToGateway only
+		Namespace: "amantya",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer backend.Close()
+
+	counter, err := backend.WithUnit("1").NewCounter("custom_metric", "Custom counter", []string{"NetworkSlice"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := counter.Inc(map[string]string{"NetworkSlice": "slice1"}); err != nil {
+		log.Fatal("Failed to update metric:", err)
+	}
+	histogram, err := backend.WithUnit("ms").NewHistogram("custom_latency", "Custom latency", nil, []float64{1, 5, 10})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := histogram.Observe(3, nil); err != nil {
+		log.Fatal("Failed to update metric:", err)
+	}
+	if err := backend.PushToGateway("", ""); err != nil {
+		log.Fatal("Failed to flush metrics:", err)
+	}
+
+	select {
+	case req := <-received:
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					log.Printf("Stand-in receiver got %s (%s, unit %q): %v", m.Name, m.Description, m.Unit, m.Data)
+				}
+			}
+		}
+	case <-time.After(2 * time.Second):
+		log.Fatal("No metrics received by the stand-in receiver")
+	}
+}
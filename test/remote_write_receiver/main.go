@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"amantya_metrics/remotewritebackend"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Writes a counter and a histogram through the remote-write backend to an
+// in-process HTTP receiver that stands in for Prometheus/Mimir. The first
+// request is answered with 503 to show the retry; the receiver checks basic
+// auth and prints the series it decodes.
+func main() {
+	received := make(chan []string, 1)
+	var failed atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "site1" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if failed.CompareAndSwap(false, true) {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		series, err := decodeWriteRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		received <- series
+	}))
+	defer receiver.Close()
+
+	backend, err := remotewritebackend.NewRemoteWriteBackend(remotewritebackend.Config{
+		URL:        receiver.URL + "/api/v1/push",
+		Interval:   time.Hour, // write on PushToGateway only
+		MaxRetries: 3,
+		Username:   "site1",
+		Password:   "secret",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	counter, err := backend.NewCounter("custom_metric", "Custom counter", []string{"NetworkSlice"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := counter.Inc(map[string]string{"NetworkSlice": "slice1"}); err != nil {
+		log.Fatal("Failed to update metric:", err)
+	}
+	histogram, err := backend.NewHistogram("custom_latency", "Custom latency", nil, []float64{1, 5})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := histogram.Observe(3, nil); err != nil {
+		log.Fatal("Failed to update metric:", err)
+	}
+	if err := backend.PushToGateway("", ""); err != nil {
+		log.Fatal("Failed to write metrics:", err)
+	}
+
+	select {
+	case series := <-received:
+		for _, s := range series {
+			log.Printf("Stand-in receiver got %s", s)
+		}
+	case <-time.After(2 * time.Second):
+		log.Fatal("No series received by the stand-in receiver")
+	}
+}
+
+// decodeWriteRequest renders each TimeSeries of a WriteRequest as
+// name{labels} value.
+func decodeWriteRequest(b []byte) ([]string, error) {
+	var out []string
+	err := eachField(b, func(num protowire.Number, ts []byte) error {
+		var labels []string
+		var name, value string
+		err := eachField(ts, func(num protowire.Number, field []byte) error {
+			switch num {
+			case 1:
+				var pair [2]string
+				err := eachField(field, func(num protowire.Number, s []byte) error {
+					pair[num-1] = string(s)
+					return nil
+				})
+				if pair[0] == "__name__" {
+					name = pair[1]
+				} else {
+					labels = append(labels, fmt.Sprintf("%s=%q", pair[0], pair[1]))
+				}
+				return err
+			case 2:
+				if len(field) > 1 && field[0] == 0x09 {
+					bits, _ := protowire.ConsumeFixed64(field[1:])
+					value = fmt.Sprint(math.Float64frombits(bits))
+				}
+			}
+			return nil
+		})
+		out = append(out, fmt.Sprintf("%s{%s} %s", name, strings.Join(labels, ","), value))
+		return err
+	})
+	return out, err
+}
+
+// eachField calls fn with the payload of every length-delimited field of b
+// and skips the others.
+func eachField(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(num, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
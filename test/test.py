@@ -9,6 +9,7 @@ MetricWithLabels = [c_char_p, POINTER(c_char_p), c_int]
 MetricWithValue = [c_char_p, c_double, POINTER(c_char_p), c_int]
 
 lib.Initialize.argtypes         = [c_char_p, c_char_p]
+lib.InitializeWithLabels.argtypes = [c_char_p, c_char_p, POINTER(c_char_p), c_int]
 lib.LoadKPIs.argtypes           = [c_char_p]
 lib.RegisterMetrics.argtypes    = []
 
@@ -16,6 +17,10 @@ lib.IncrementMetric.argtypes    = MetricWithLabels
 lib.DecrementMetric.argtypes    = MetricWithLabels
 lib.AddToMetric.argtypes        = MetricWithValue
 lib.SetMetric.argtypes          = MetricWithValue
+lib.ObserveMetric.argtypes      = MetricWithValue
+lib.GetMetricValue.argtypes     = [c_char_p, POINTER(c_char_p), c_int, POINTER(c_double)]
+lib.DeleteSeries.argtypes       = MetricWithLabels
+lib.DeletePartialMatch.argtypes = MetricWithLabels
 
 lib.PushMetrics.argtypes        = [c_char_p, c_char_p]
 lib.ListMetrics.restype         = POINTER(c_char_p)
@@ -2,20 +2,48 @@ package main
 
 import (
 	"log"
+	"net"
+	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"amantya_metrics/datadogbackend"
 )
 
+// Sends a metric through the Datadog backend to a local UDP listener that
+// stands in for the DogStatsD agent, and prints what the agent receives.
 func main() {
-	client, err := statsd.New("127.0.0.1:8125")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer conn.Close()
 
-	err = client.Count("amantya.custom.metric", 1, nil, 1)
+	backend, err := datadogbackend.NewDataDogBackend(datadogbackend.Config{
+		Address:   conn.LocalAddr().String(),
+		Namespace: "amantya",
+		Tags:      []string{"env:test"},
+		Transport: datadogbackend.TransportUDP,
+	})
 	if err != nil {
+		log.Fatal(err)
+	}
+
+	counter, err := backend.NewCounter("custom_metric", "", []string{"NetworkSlice"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := counter.Inc(map[string]string{"NetworkSlice": "slice1"}); err != nil {
 		log.Fatal("Failed to send metric:", err)
 	}
+	if err := backend.PushToGateway("", ""); err != nil {
+		log.Fatal("Failed to flush metrics:", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		log.Fatal("No metric received by the stand-in agent:", err)
+	}
 
-	log.Println("Metric sent to Datadog agent successfully!")
+	log.Printf("Stand-in agent received: %s", buf[:n])
 }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"amantya_metrics/metricsInterface"
 	"errors"
 	"fmt"
 )
@@ -28,9 +29,13 @@ func NewMetricError(operation, metric string, err error) *MetricError {
 }
 
 func IsMetricNotFound(err error) bool {
-	return errors.Is(err, errors.New("metric not found"))
+	return errors.Is(err, metricsInterface.ErrMetricNotFound)
 }
 
 func IsInvalidOperation(err error) bool {
-	return errors.Is(err, errors.New("invalid operation for metric type"))
+	return errors.Is(err, metricsInterface.ErrInvalidOperation)
+}
+
+func IsOperationNotPermitted(err error) bool {
+	return errors.Is(err, metricsInterface.ErrOperationNotPermitted)
 }